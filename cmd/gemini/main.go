@@ -4,7 +4,10 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strings"
@@ -21,11 +24,13 @@ import (
 	"ai_gemini_mod/gemini"
 )
 
-
 const (
-	retryAttempts    = 3
-	retryBaseDelay   = 500 * time.Millisecond
-	retryTotalAttempts = retryAttempts + 1 // initial attempt + retries
+	maxRetries     = 3 // after the first attempt: four attempts in total
+	retryBaseDelay = 500 * time.Millisecond
+
+	maxCandidates      = 8
+	maxStopSequences   = 5
+	candidateDelimiter = "\n---\n"
 )
 
 // Config holds CLI configuration loaded from environment.
@@ -36,6 +41,7 @@ type Config struct {
 	Temperature  float64       `env:"GEMINI_TEMPERATURE" default:"1.0"`
 	Timeout      time.Duration `env:"GEMINI_TIMEOUT" default:"30s"`
 	GoogleSearch bool          `env:"GEMINI_GOOGLE_SEARCH" default:"true"`
+	Safety       string        `env:"GEMINI_SAFETY"` // e.g. "harassment=block_none,hate=block_low"
 	LogLevel     string        `env:"LOG_LEVEL" default:"error"`
 }
 
@@ -59,33 +65,75 @@ func main() {
 	registry.ShutdownCLI(0)
 }
 
+// usage is the synopsis shared by -h and the missing-prompt error.
+const usage = "usage: gemini [flags] [--] <prompt> | gemini [flags] -file <path>"
+
+// run executes the CLI. -h prints the flag help and returns nil; a prompt
+// starting with "-" must follow "--" so it is not parsed as a flag.
 func run(args []string) error {
+	fs := flag.NewFlagSet("gemini", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	decodeMedia := fs.Bool("decode-media", false, "print a mime type and byte length summary instead of base64 inline data")
+	candidates := fs.Int("n", 1, "number of candidates to generate (1-8)")
+	promptFile := fs.String("file", "", "read the prompt from this file instead of the arguments")
+	format := fs.String("format", "json", "output format: json (full response), text (candidate text only), or text+usage (text plus token counts on stderr)")
+	var sampling samplingFlags
+	sampling.register(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	samplingOpts, err := sampling.options(fs)
+	if err != nil {
+		return err
+	}
+	args = fs.Args()
+	if *candidates < 1 || *candidates > maxCandidates {
+		return fmt.Errorf("-n must be between 1 and %d, got %d", maxCandidates, *candidates)
+	}
+	switch *format {
+	case "json", "text", "text+usage":
+	default:
+		return fmt.Errorf("-format must be json, text, or text+usage, got %q", *format)
+	}
+	prompt, err := readPrompt(*promptFile, args)
+	if err != nil {
+		return err
+	}
+
 	cfg := chassisconfig.MustLoad[Config]()
 	logger := logz.New(cfg.LogLevel)
 	logger.Info("starting", "chassis", chassis.Version)
 
-	if len(args) == 0 {
-		return fmt.Errorf("usage: gemini <prompt>")
-	}
-	prompt := strings.Join(args, " ")
-
 	logger.Debug("request config", "model", cfg.Model, "max_tokens", cfg.MaxTokens, "temperature", cfg.Temperature)
 
-	caller := call.New(
-		call.WithTimeout(cfg.Timeout),
-		call.WithRetry(retryAttempts, retryBaseDelay),
-	)
+	// Retries use gemini.WithRetry rather than call.WithRetry so that the
+	// deadline below is computed from the backoff that actually runs.
+	caller := call.New(call.WithTimeout(cfg.Timeout))
+
+	safety, err := parseSafety(cfg.Safety)
+	if err != nil {
+		return err
+	}
 
 	client, err := gemini.New(cfg.APIKey,
 		gemini.WithModel(cfg.Model),
 		gemini.WithDoer(caller),
+		gemini.WithRetry(maxRetries, retryBaseDelay),
+		gemini.WithUsageLogger(logger),
+		gemini.WithDefaultSafetySettings(safety...),
 	)
 	if err != nil {
 		return err
 	}
 
-	// Allow enough time for all retry attempts; +1 provides buffer for backoff gaps.
-	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout*time.Duration(retryTotalAttempts+1))
+	// Allow enough time for every attempt plus the backoff gaps between them.
+	ctx, cancel := context.WithTimeout(context.Background(), gemini.EstimateMaxDuration(cfg.Timeout, maxRetries, retryBaseDelay))
 	defer cancel()
 
 	genOpts := []gemini.GenerateOption{
@@ -95,16 +143,187 @@ func run(args []string) error {
 	if cfg.GoogleSearch {
 		genOpts = append(genOpts, gemini.WithGoogleSearch())
 	}
+	if *candidates > 1 {
+		genOpts = append(genOpts, gemini.WithCandidateCount(*candidates))
+	}
+	genOpts = append(genOpts, samplingOpts...)
 
 	resp, err := client.Generate(ctx, prompt, genOpts...)
 	if err != nil {
 		return err
 	}
 
+	switch *format {
+	case "text":
+		return writeText(os.Stdout, resp)
+	case "text+usage":
+		if err := writeText(os.Stdout, resp); err != nil {
+			return err
+		}
+		return writeUsage(os.Stderr, resp.UsageMetadata)
+	}
+	return writeResponse(os.Stdout, resp, *decodeMedia)
+}
+
+// readPrompt returns the prompt from the -file path, or else the positional
+// arguments joined by spaces. Giving both is an error.
+func readPrompt(file string, args []string) (string, error) {
+	if file == "" {
+		if len(args) == 0 {
+			return "", errors.New(usage)
+		}
+		return strings.Join(args, " "), nil
+	}
+	if len(args) > 0 {
+		return "", fmt.Errorf("-file and a positional prompt are mutually exclusive")
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("-file: %w", err)
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return "", fmt.Errorf("-file %s is empty", file)
+	}
+	return string(data), nil
+}
+
+// parseSafety parses GEMINI_SAFETY, a comma-separated list of
+// category=threshold pairs, into safety settings. Empty means none.
+func parseSafety(s string) ([]gemini.SafetySetting, error) {
+	m := make(map[string]string)
+	for entry := range strings.SplitSeq(s, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("GEMINI_SAFETY: entry %q is not category=threshold", entry)
+		}
+		k = strings.TrimSpace(k)
+		if _, dup := m[k]; dup {
+			return nil, fmt.Errorf("GEMINI_SAFETY: category %q given more than once", k)
+		}
+		m[k] = v
+	}
+	settings, err := gemini.SafetySettingsFromMap(m)
+	if err != nil {
+		return nil, fmt.Errorf("GEMINI_SAFETY: %w", err)
+	}
+	return settings, nil
+}
+
+// samplingFlags holds the optional sampling flags. Each maps to a
+// GenerateOption only when given on the command line, so the API defaults
+// apply otherwise.
+type samplingFlags struct {
+	topP float64
+	topK int
+	seed int
+	stop []string
+}
+
+func (s *samplingFlags) register(fs *flag.FlagSet) {
+	fs.Float64Var(&s.topP, "top-p", 0, "nucleus sampling probability mass (0-1)")
+	fs.IntVar(&s.topK, "top-k", 0, "sample from the k most likely tokens (>= 1)")
+	fs.IntVar(&s.seed, "seed", 0, "sampling seed for more reproducible output")
+	fs.Func("stop", fmt.Sprintf("stop sequence; repeat for up to %d", maxStopSequences), func(v string) error {
+		s.stop = append(s.stop, v)
+		return nil
+	})
+}
+
+// options validates the flags set on fs and returns their GenerateOptions.
+func (s *samplingFlags) options(fs *flag.FlagSet) ([]gemini.GenerateOption, error) {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var opts []gemini.GenerateOption
+	if set["top-p"] {
+		if s.topP < 0 || s.topP > 1 {
+			return nil, fmt.Errorf("-top-p must be between 0 and 1, got %g", s.topP)
+		}
+		opts = append(opts, gemini.WithTopP(s.topP))
+	}
+	if set["top-k"] {
+		if s.topK < 1 {
+			return nil, fmt.Errorf("-top-k must be at least 1, got %d", s.topK)
+		}
+		opts = append(opts, gemini.WithTopK(s.topK))
+	}
+	if set["seed"] {
+		opts = append(opts, gemini.WithSeed(s.seed))
+	}
+	if set["stop"] {
+		if len(s.stop) > maxStopSequences {
+			return nil, fmt.Errorf("-stop may be given at most %d times, got %d", maxStopSequences, len(s.stop))
+		}
+		for _, seq := range s.stop {
+			if seq == "" {
+				return nil, fmt.Errorf("-stop must not be empty")
+			}
+		}
+		opts = append(opts, gemini.WithStopSequences(s.stop...))
+	}
+	return opts, nil
+}
+
+// writeUsage prints token counts, one per line. The cached line appears only
+// when part of the prompt was served from a cached context.
+func writeUsage(w io.Writer, u gemini.UsageMetadata) error {
+	lines := fmt.Sprintf("prompt: %d\ncandidates: %d\ntotal: %d\n", u.PromptTokenCount, u.CandidatesTokenCount, u.TotalTokenCount)
+	if u.CachedContentTokenCount > 0 {
+		lines += fmt.Sprintf("cached: %d\n", u.CachedContentTokenCount)
+	}
+	_, err := io.WriteString(w, lines)
+	return err
+}
+
+// writeText prints the text of each candidate, separated by a delimiter line.
+func writeText(w io.Writer, resp *gemini.Response) error {
+	texts := make([]string, len(resp.Candidates))
+	for i, cand := range resp.Candidates {
+		texts[i] = cand.Text()
+	}
+	_, err := fmt.Fprintln(w, strings.Join(texts, candidateDelimiter))
+	return err
+}
+
+// writeResponse prints resp as indented JSON. With decodeMedia, inline data
+// blobs are replaced by a short summary to keep the output readable.
+func writeResponse(w io.Writer, resp *gemini.Response, decodeMedia bool) error {
+	if decodeMedia {
+		resp = summarizeMedia(resp)
+	}
 	out, err := json.MarshalIndent(resp, "", "  ")
 	if err != nil {
 		return fmt.Errorf("formatting response: %w", err)
 	}
-	fmt.Println(string(out))
-	return nil
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
+
+// summarizeMedia returns a copy of resp whose inline data is replaced by a
+// "[mime/type, N bytes]" summary. The original response is not modified.
+func summarizeMedia(resp *gemini.Response) *gemini.Response {
+	out := *resp
+	out.Candidates = make([]gemini.Candidate, len(resp.Candidates))
+	for i, cand := range resp.Candidates {
+		parts := make([]gemini.ResponsePart, len(cand.Content.Parts))
+		for j, p := range cand.Content.Parts {
+			if p.InlineData != nil {
+				summary := "undecodable base64"
+				if data, err := p.InlineData.Decode(); err == nil {
+					summary = fmt.Sprintf("%d bytes", len(data))
+				}
+				p.InlineData = &gemini.InlineData{
+					MimeType: p.InlineData.MimeType,
+					Data:     fmt.Sprintf("[%s, %s]", p.InlineData.MimeType, summary),
+				}
+			}
+			parts[j] = p
+		}
+		cand.Content.Parts = parts
+		out.Candidates[i] = cand
+	}
+	return &out
 }
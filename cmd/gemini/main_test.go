@@ -1,12 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	chassis "github.com/ai8future/chassis-go/v11"
 	chassisconfig "github.com/ai8future/chassis-go/v11/config"
 	"github.com/ai8future/chassis-go/v11/testkit"
+
+	"ai_gemini_mod/gemini"
 )
 
 func TestMain(m *testing.M) {
@@ -87,3 +96,231 @@ func TestConfig_PanicsWithoutAPIKey(t *testing.T) {
 	}()
 	_ = chassisconfig.MustLoad[Config]()
 }
+
+func mockImageResponse(t *testing.T, img []byte) *gemini.Response {
+	t.Helper()
+	body := `{"candidates":[{"content":{"role":"model","parts":[
+		{"text":"Here you go."},
+		{"inlineData":{"mimeType":"image/png","data":"` + base64.StdEncoding.EncodeToString(img) + `"}}
+	]},"finishReason":"STOP"}]}`
+	var resp gemini.Response
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("unmarshal mock response: %v", err)
+	}
+	return &resp
+}
+
+func TestWriteResponse_DecodeMedia(t *testing.T) {
+	img := bytes.Repeat([]byte{0xAB}, 300)
+	blob := base64.StdEncoding.EncodeToString(img)
+	resp := mockImageResponse(t, img)
+
+	var buf bytes.Buffer
+	if err := writeResponse(&buf, resp, true); err != nil {
+		t.Fatalf("writeResponse: %v", err)
+	}
+	out := buf.String()
+	if strings.Contains(out, blob) {
+		t.Error("base64 blob should be replaced by a summary")
+	}
+	if !strings.Contains(out, "[image/png, 300 bytes]") {
+		t.Errorf("expected media summary in output, got:\n%s", out)
+	}
+	if !strings.Contains(out, "Here you go.") {
+		t.Errorf("text parts should be preserved, got:\n%s", out)
+	}
+	if resp.Candidates[0].Content.Parts[1].InlineData.Data != blob {
+		t.Error("summarizing must not modify the original response")
+	}
+}
+
+func TestWriteResponse_RawMediaByDefault(t *testing.T) {
+	img := []byte("png-bytes")
+	resp := mockImageResponse(t, img)
+
+	var buf bytes.Buffer
+	if err := writeResponse(&buf, resp, false); err != nil {
+		t.Fatalf("writeResponse: %v", err)
+	}
+	if !strings.Contains(buf.String(), base64.StdEncoding.EncodeToString(img)) {
+		t.Errorf("expected base64 data without -decode-media, got:\n%s", buf.String())
+	}
+}
+
+func TestWriteText_MultipleCandidates(t *testing.T) {
+	resp := &gemini.Response{Candidates: []gemini.Candidate{
+		{Content: gemini.ResponseContent{Parts: []gemini.ResponsePart{{Text: "first"}}}},
+		{Content: gemini.ResponseContent{Parts: []gemini.ResponsePart{{Text: "sec"}, {Text: "ond"}}}},
+	}}
+
+	var buf bytes.Buffer
+	if err := writeText(&buf, resp); err != nil {
+		t.Fatalf("writeText: %v", err)
+	}
+	if want := "first\n---\nsecond\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteUsage(t *testing.T) {
+	tests := []struct {
+		name  string
+		usage gemini.UsageMetadata
+		want  string
+	}{
+		{"no cache", gemini.UsageMetadata{PromptTokenCount: 10, CandidatesTokenCount: 5, TotalTokenCount: 15},
+			"prompt: 10\ncandidates: 5\ntotal: 15\n"},
+		{"cached", gemini.UsageMetadata{PromptTokenCount: 1000, CandidatesTokenCount: 5, TotalTokenCount: 1005, CachedContentTokenCount: 800},
+			"prompt: 1000\ncandidates: 5\ntotal: 1005\ncached: 800\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeUsage(&buf, tt.usage); err != nil {
+				t.Fatalf("writeUsage: %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("got %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_InvalidFlags(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{[]string{"-n", "0", "hi"}, "-n must be between 1 and 8"},
+		{[]string{"-n", "9", "hi"}, "-n must be between 1 and 8"},
+		{[]string{"-format", "yaml", "hi"}, "-format must be json, text, or text+usage"},
+		{[]string{"-top-p", "1.5", "hi"}, "-top-p must be between 0 and 1"},
+		{[]string{"-top-k", "0", "hi"}, "-top-k must be at least 1"},
+		{[]string{"-stop", "a", "-stop", "b", "-stop", "c", "-stop", "d", "-stop", "e", "-stop", "f", "hi"}, "-stop may be given at most 5 times"},
+		{[]string{"-stop", "", "hi"}, "-stop must not be empty"},
+		{[]string{"-file", "prompt.txt", "hi"}, "-file and a positional prompt are mutually exclusive"},
+		{[]string{"-file", "does-not-exist.txt"}, "-file: open does-not-exist.txt"},
+	}
+	for _, tt := range tests {
+		err := run(tt.args)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("run(%v): expected error containing %q, got %v", tt.args, tt.wantErr, err)
+		}
+	}
+}
+
+func TestRun_Help(t *testing.T) {
+	for _, arg := range []string{"-h", "-help", "--help"} {
+		if err := run([]string{arg}); err != nil {
+			t.Errorf("run(%s): expected nil, got %v", arg, err)
+		}
+	}
+}
+
+func TestRun_DashPrompt(t *testing.T) {
+	// Without "--" a leading dash is parsed as an unknown flag.
+	if err := run([]string{"-1 is negative"}); err == nil || !strings.Contains(err.Error(), "flag provided but not defined") {
+		t.Errorf("without --: expected unknown flag error, got %v", err)
+	}
+	// After "--" it is a positional prompt, which here conflicts with -file.
+	err := run([]string{"-file", "prompt.txt", "--", "-1 is negative"})
+	if err == nil || !strings.Contains(err.Error(), "-file and a positional prompt are mutually exclusive") {
+		t.Errorf("with --: expected positional prompt, got %v", err)
+	}
+	if got, err := readPrompt("", []string{"-1", "is", "negative"}); err != nil || got != "-1 is negative" {
+		t.Errorf("readPrompt: got %q, %v", got, err)
+	}
+}
+
+func TestReadPrompt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "prompt.txt")
+	if err := os.WriteFile(path, []byte("Summarize:\nline two\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty.txt")
+	if err := os.WriteFile(empty, []byte(" \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := readPrompt(path, nil); err != nil || got != "Summarize:\nline two\n" {
+		t.Errorf("file: got %q, %v", got, err)
+	}
+	if got, err := readPrompt("", []string{"hello", "world"}); err != nil || got != "hello world" {
+		t.Errorf("args: got %q, %v", got, err)
+	}
+	for _, tt := range []struct {
+		file string
+		args []string
+	}{
+		{"", nil},
+		{path, []string{"hi"}},
+		{empty, nil},
+		{dir, nil},
+	} {
+		if _, err := readPrompt(tt.file, tt.args); err == nil {
+			t.Errorf("readPrompt(%q, %q): expected error", tt.file, tt.args)
+		}
+	}
+}
+
+func TestParseSafety(t *testing.T) {
+	got, err := parseSafety("harassment=block_none, hate=block_low")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []gemini.SafetySetting{
+		{Category: gemini.HarmCategoryHarassment, Threshold: gemini.HarmBlockNone},
+		{Category: gemini.HarmCategoryHateSpeech, Threshold: gemini.HarmBlockLowAndAbove},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if got, err := parseSafety(""); err != nil || len(got) != 0 {
+		t.Errorf("empty: got %+v, %v", got, err)
+	}
+	for _, s := range []string{"harassment", "violence=block_none", "hate=block_some", "hate=block_low,hate=off"} {
+		if _, err := parseSafety(s); err == nil {
+			t.Errorf("parseSafety(%q): expected error", s)
+		}
+	}
+}
+
+func TestSamplingFlags(t *testing.T) {
+	client, err := gemini.New("key")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	build := func(args ...string) gemini.GenerationConfig {
+		t.Helper()
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		var s samplingFlags
+		s.register(fs)
+		if err := fs.Parse(args); err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		opts, err := s.options(fs)
+		if err != nil {
+			t.Fatalf("options: %v", err)
+		}
+		req, err := client.BuildRequest("hi", opts...)
+		if err != nil {
+			t.Fatalf("BuildRequest: %v", err)
+		}
+		return req.GenerationConfig
+	}
+
+	gc := build()
+	if gc.TopP != nil || gc.TopK != nil || gc.Seed != nil || gc.StopSequences != nil {
+		t.Errorf("unset flags should be omitted: %+v", gc)
+	}
+
+	gc = build("-top-p", "0.9", "-top-k", "40", "-seed", "0", "-stop", "END", "-stop", "###")
+	if gc.TopP == nil || *gc.TopP != 0.9 || gc.TopK == nil || *gc.TopK != 40 || gc.Seed == nil || *gc.Seed != 0 {
+		t.Errorf("sampling flags not applied: %+v", gc)
+	}
+	if len(gc.StopSequences) != 2 || gc.StopSequences[0] != "END" || gc.StopSequences[1] != "###" {
+		t.Errorf("stop sequences: got %q", gc.StopSequences)
+	}
+}
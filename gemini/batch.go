@@ -0,0 +1,52 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	chassiserrors "github.com/ai8future/chassis-go/v11/errors"
+)
+
+// GenerateBatch runs Generate for each prompt with at most concurrency calls
+// in flight. Responses and errors are aligned with prompts by index; exactly
+// one of the two is set for each prompt. Once ctx is done, prompts not yet
+// started fail with ctx.Err(). It returns after every call has finished.
+func (c *Client) GenerateBatch(ctx context.Context, prompts []string, concurrency int, opts ...GenerateOption) ([]*Response, []error) {
+	resps := make([]*Response, len(prompts))
+	errs := make([]error, len(prompts))
+	if concurrency < 1 {
+		err := chassiserrors.ValidationError(fmt.Sprintf("gemini: batch concurrency must be at least 1, got %d", concurrency))
+		for i := range errs {
+			errs[i] = err
+		}
+		return resps, errs
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(concurrency, len(prompts)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				resps[i], errs[i] = c.Generate(ctx, prompts[i], opts...)
+			}
+		}()
+	}
+
+dispatch:
+	for i := range prompts {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			for j := i; j < len(prompts); j++ {
+				errs[j] = ctx.Err()
+			}
+			break dispatch
+		}
+	}
+	close(next)
+	wg.Wait()
+	return resps, errs
+}
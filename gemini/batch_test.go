@@ -0,0 +1,105 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// inFlightDoer echoes the prompt back and tracks the peak number of
+// concurrent requests.
+type inFlightDoer struct {
+	cur, peak atomic.Int32
+	delay     time.Duration
+}
+
+func (d *inFlightDoer) Do(req *http.Request) (*http.Response, error) {
+	n := d.cur.Add(1)
+	defer d.cur.Add(-1)
+	for {
+		p := d.peak.Load()
+		if n <= p || d.peak.CompareAndSwap(p, n) {
+			break
+		}
+	}
+	select {
+	case <-time.After(d.delay):
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	var body Request
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	text := body.Contents[0].Parts[0].Text
+	resp := fmt.Sprintf(`{"candidates":[{"content":{"parts":[{"text":%q}]}}]}`, "re: "+text)
+	return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(resp))}, nil
+}
+
+func TestGenerateBatch_BoundedConcurrency(t *testing.T) {
+	doer := &inFlightDoer{delay: 5 * time.Millisecond}
+	c := mustNew(t, "key", WithDoer(doer))
+
+	prompts := make([]string, 20)
+	for i := range prompts {
+		prompts[i] = fmt.Sprintf("p%d", i)
+	}
+	resps, errs := c.GenerateBatch(context.Background(), prompts, 3)
+	for i := range prompts {
+		if errs[i] != nil {
+			t.Fatalf("prompt %d: unexpected error: %v", i, errs[i])
+		}
+		if want := "re: " + prompts[i]; resps[i].Text() != want {
+			t.Errorf("prompt %d: got %q, want %q", i, resps[i].Text(), want)
+		}
+	}
+	if peak := doer.peak.Load(); peak > 3 || peak < 2 {
+		t.Errorf("peak in-flight: got %d, want at most 3 (and some overlap)", peak)
+	}
+}
+
+func TestGenerateBatch_StopsOnCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	doer := &inFlightDoer{delay: time.Hour}
+	c := mustNew(t, "key", WithDoer(doer))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	resps, errs := c.GenerateBatch(ctx, make([]string, 10), 2)
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("batch should stop when the context is done")
+	}
+	for i, err := range errs {
+		if err == nil || resps[i] != nil {
+			t.Errorf("prompt %d: got (%v, %v), want an error", i, resps[i], err)
+		}
+	}
+	if !errors.Is(errs[9], context.DeadlineExceeded) {
+		t.Errorf("unstarted prompt: got %v, want deadline exceeded", errs[9])
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("goroutines: %d before, %d after", before, n)
+	}
+}
+
+func TestGenerateBatch_InvalidConcurrency(t *testing.T) {
+	c := mustNew(t, "key", WithDoer(&inFlightDoer{}))
+	_, errs := c.GenerateBatch(context.Background(), []string{"a", "b"}, 0)
+	if len(errs) != 2 || errs[0] == nil || errs[1] == nil {
+		t.Errorf("expected an error per prompt, got %v", errs)
+	}
+}
@@ -0,0 +1,138 @@
+package gemini
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// responseCache is an in-memory LRU of successful responses keyed by a hash
+// of the endpoint and serialized request. Entries are stored as JSON so every
+// hit returns an independent copy. A second instance holds token counts.
+type responseCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key        string
+	body       []byte
+	responseID string
+	tokens     int       // countTokens result, for the token count cache
+	expires    time.Time // zero means no expiry
+}
+
+func newResponseCache(size int, ttl time.Duration) *responseCache {
+	return &responseCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// cacheKey hashes the endpoint and request body.
+func cacheKey(endpoint string, reqBody any) (string, error) {
+	data, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(endpoint))
+	h.Write([]byte{0})
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// get returns a copy of the cached response for key, if present and fresh.
+func (rc *responseCache) get(key string, now time.Time) (*Response, bool) {
+	e, ok := rc.lookup(key, now)
+	if !ok {
+		return nil, false
+	}
+	var resp Response
+	if err := json.Unmarshal(e.body, &resp); err != nil {
+		return nil, false
+	}
+	resp.ResponseID = e.responseID
+	return &resp, true
+}
+
+// put stores resp under key, evicting the least recently used entry when full.
+func (rc *responseCache) put(key string, resp *Response, now time.Time) {
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	rc.store(&cacheEntry{key: key, body: body, responseID: resp.ResponseID}, now)
+}
+
+// getTokens returns the cached token count for key, if present and fresh.
+func (rc *responseCache) getTokens(key string, now time.Time) (int, bool) {
+	e, ok := rc.lookup(key, now)
+	if !ok {
+		return 0, false
+	}
+	return e.tokens, true
+}
+
+// putTokens stores a token count under key.
+func (rc *responseCache) putTokens(key string, tokens int, now time.Time) {
+	rc.store(&cacheEntry{key: key, tokens: tokens}, now)
+}
+
+// lookup returns the fresh entry for key and marks it most recently used,
+// dropping it if expired.
+func (rc *responseCache) lookup(key string, now time.Time) (*cacheEntry, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	el, ok := rc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*cacheEntry)
+	if !e.expires.IsZero() && !now.Before(e.expires) {
+		rc.order.Remove(el)
+		delete(rc.entries, key)
+		return nil, false
+	}
+	rc.order.MoveToFront(el)
+	return e, true
+}
+
+// store adds e, setting its expiry and evicting the least recently used
+// entry when full.
+func (rc *responseCache) store(e *cacheEntry, now time.Time) {
+	if rc.ttl > 0 {
+		e.expires = now.Add(rc.ttl)
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	key := e.key
+	if el, ok := rc.entries[key]; ok {
+		el.Value = e
+		rc.order.MoveToFront(el)
+		return
+	}
+	rc.entries[key] = rc.order.PushFront(e)
+	if rc.order.Len() > rc.size {
+		oldest := rc.order.Back()
+		rc.order.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// clear removes all entries.
+func (rc *responseCache) clear() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.order.Init()
+	clear(rc.entries)
+}
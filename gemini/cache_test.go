@@ -0,0 +1,175 @@
+package gemini
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countDoer returns okBody and counts calls.
+type countDoer struct {
+	calls atomic.Int32
+}
+
+func (d *countDoer) Do(req *http.Request) (*http.Response, error) {
+	d.calls.Add(1)
+	return &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"X-Goog-Request-Id": {"srv-1"}},
+		Body:       io.NopCloser(strings.NewReader(okBody)),
+	}, nil
+}
+
+func TestWithCache_SecondCallServedFromCache(t *testing.T) {
+	doer := &countDoer{}
+	c := mustNew(t, "key", WithDoer(doer), WithCache(10, time.Minute))
+
+	first, err := c.Generate(context.Background(), "same prompt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := c.Generate(context.Background(), "same prompt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := doer.calls.Load(); n != 1 {
+		t.Errorf("Doer calls: got %d, want 1", n)
+	}
+	if second.Text() != "ok" || second.ResponseID != "srv-1" {
+		t.Errorf("cached response: got text %q, ID %q", second.Text(), second.ResponseID)
+	}
+	if first == second {
+		t.Error("each hit should return an independent copy")
+	}
+}
+
+func TestWithCache_HitIsIndependentCopy(t *testing.T) {
+	c := mustNew(t, "key", WithDoer(&countDoer{}), WithCache(10, 0))
+
+	first, _ := c.Generate(context.Background(), "p")
+	first.Candidates[0].Content.Parts[0].Text = "mutated"
+
+	second, err := c.Generate(context.Background(), "p")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if second.Text() != "ok" {
+		t.Errorf("cache corrupted by caller mutation: %q", second.Text())
+	}
+}
+
+func TestWithCache_KeyIncludesOptions(t *testing.T) {
+	doer := &countDoer{}
+	c := mustNew(t, "key", WithDoer(doer), WithCache(10, 0))
+
+	_, _ = c.Generate(context.Background(), "p")
+	_, _ = c.Generate(context.Background(), "p", WithTemperature(0.1))
+	_, _ = c.Generate(context.Background(), "other")
+	if n := doer.calls.Load(); n != 3 {
+		t.Errorf("Doer calls: got %d, want 3", n)
+	}
+}
+
+func TestWithCache_TTLExpiry(t *testing.T) {
+	clk := newFakeClock()
+	doer := &countDoer{}
+	c := mustNew(t, "key", WithDoer(doer), WithCache(10, time.Minute), withClock(clk))
+
+	_, _ = c.Generate(context.Background(), "p")
+	clk.Advance(59 * time.Second)
+	_, _ = c.Generate(context.Background(), "p")
+	if n := doer.calls.Load(); n != 1 {
+		t.Fatalf("Doer calls before expiry: got %d, want 1", n)
+	}
+	clk.Advance(time.Second)
+	_, _ = c.Generate(context.Background(), "p")
+	if n := doer.calls.Load(); n != 2 {
+		t.Errorf("Doer calls after expiry: got %d, want 2", n)
+	}
+}
+
+func TestWithCache_LRUEviction(t *testing.T) {
+	doer := &countDoer{}
+	c := mustNew(t, "key", WithDoer(doer), WithCache(2, 0))
+
+	for _, p := range []string{"a", "b", "a", "c", "a", "b"} {
+		if _, err := c.Generate(context.Background(), p); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// a, b miss; a hits; c misses and evicts b; a hits; b misses.
+	if n := doer.calls.Load(); n != 4 {
+		t.Errorf("Doer calls: got %d, want 4", n)
+	}
+}
+
+func TestClearCache(t *testing.T) {
+	doer := &countDoer{}
+	c := mustNew(t, "key", WithDoer(doer), WithCache(10, 0))
+
+	_, _ = c.Generate(context.Background(), "p")
+	c.ClearCache()
+	_, _ = c.Generate(context.Background(), "p")
+	if n := doer.calls.Load(); n != 2 {
+		t.Errorf("Doer calls: got %d, want 2", n)
+	}
+
+	mustNew(t, "key", WithDoer(doer)).ClearCache() // no-op without a cache
+}
+
+func TestWithCache_CancelledContext(t *testing.T) {
+	c := mustNew(t, "key", WithDoer(&countDoer{}), WithCache(10, 0))
+	_, _ = c.Generate(context.Background(), "p")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Generate(ctx, "p"); err != context.Canceled {
+		t.Errorf("expected context.Canceled on a cached prompt, got %v", err)
+	}
+}
+
+func TestWithCache_Invalid(t *testing.T) {
+	if _, err := New("key", WithCache(0, time.Minute)); err == nil {
+		t.Error("expected error for zero size")
+	}
+	if _, err := New("key", WithCache(10, -time.Second)); err == nil {
+		t.Error("expected error for negative TTL")
+	}
+}
+
+func TestWithCache_CountTokens(t *testing.T) {
+	doer := &methodDoer{bodies: map[string]string{"countTokens": `{"totalTokens":7}`}}
+	c := mustNew(t, "key", WithDoer(doer), WithCache(10, time.Minute))
+	ctx := context.Background()
+
+	for range 2 {
+		n, err := c.CountTokens(ctx, "same prompt")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n != 7 {
+			t.Errorf("tokens: got %d, want 7", n)
+		}
+	}
+	if len(doer.calls) != 1 {
+		t.Fatalf("second identical count should hit the cache, got calls %v", doer.calls)
+	}
+
+	// Anything that changes the counted request is a miss.
+	_, _ = c.CountTokens(ctx, "other prompt")
+	_, _ = c.CountTokens(ctx, "same prompt", WithSystemInstruction("be brief"))
+	_, _ = c.CountTokens(ctx, "same prompt", WithRequestModel("gemini-2.5-pro"))
+	if len(doer.calls) != 4 {
+		t.Errorf("countTokens calls: got %d, want 4", len(doer.calls))
+	}
+
+	c.ClearCache()
+	_, _ = c.CountTokens(ctx, "same prompt")
+	if len(doer.calls) != 5 {
+		t.Errorf("cleared cache should miss, got %d countTokens calls", len(doer.calls))
+	}
+}
@@ -2,14 +2,23 @@ package gemini
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	chassiserrors "github.com/ai8future/chassis-go/v11/errors"
 )
@@ -22,28 +31,147 @@ const (
 	maxErrorBodyBytes = 1024             // truncate error bodies in messages
 	maxTemperature    = 2.0
 	maxMaxTokens      = 1_000_000
+	maxInlineBytes    = 20 * 1024 * 1024       // 20 MB request limit; larger media needs the File API
+	inlineWarnBytes   = maxInlineBytes * 3 / 4 // warn when inline data approaches the limit
+	maxVideoFPS       = 24
+	maxCandidateCount = 8
+	maxLogprobs       = 20
+	maxStopSequences  = 5
+	gzipMinBytes      = 1024 // WithRequestGzip leaves smaller bodies uncompressed
+
+	metadataOnlyTextBytes = 256 // text kept per candidate by WithMetadataOnly
+
+	requestIDHeader  = "x-request-id"      // caller-supplied trace ID (WithRequestID)
+	responseIDHeader = "x-goog-request-id" // server correlation ID (Response.ResponseID)
 )
 
-// validModel matches model names: alphanumeric, dots, hyphens, underscores, slashes.
-var validModel = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._/-]*$`)
+// validModel matches model names: slash-separated segments of alphanumerics,
+// dots, hyphens, and underscores, each starting with an alphanumeric so that
+// "." and ".." segments cannot move the request path out of /models/.
+var validModel = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*(/[a-zA-Z0-9][a-zA-Z0-9._-]*)*$`)
+
+// Billing label limits: at most 64 labels; keys start with a lowercase letter;
+// keys and values are at most 63 lowercase letters, digits, underscores, or hyphens.
+const maxLabels = 64
+
+var (
+	validLabelKey   = regexp.MustCompile(`^[\p{Ll}\p{Lo}][\p{Ll}\p{Lo}\p{N}_-]{0,62}$`)
+	validLabelValue = regexp.MustCompile(`^[\p{Ll}\p{Lo}\p{N}_-]{0,63}$`)
+)
 
 // Doer executes HTTP requests. Satisfied by *http.Client, call.Client, and test mocks.
 type Doer interface {
 	Do(*http.Request) (*http.Response, error)
 }
 
+// DoerFunc adapts an ordinary function to the Doer interface, like
+// http.HandlerFunc. It is handy for tests and small middleware.
+type DoerFunc func(*http.Request) (*http.Response, error)
+
+// Do calls f(req).
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Logger receives diagnostic messages from the client. *slog.Logger satisfies it.
+type Logger interface {
+	Warn(msg string, args ...any)
+}
+
+// UsageLogger receives per-call token usage at info level. *slog.Logger and
+// the chassis logz logger satisfy it.
+type UsageLogger interface {
+	Info(msg string, args ...any)
+}
+
+// Generator is the generation surface of *Client. Consumers can accept a
+// Generator instead of *Client and substitute a fake in tests without any
+// HTTP plumbing.
+type Generator interface {
+	Generate(ctx context.Context, prompt string, opts ...GenerateOption) (*Response, error)
+}
+
+var _ Generator = (*Client)(nil)
+
 // Client is a Gemini API client.
+//
+// A Client is safe for concurrent use by multiple goroutines: its fields are
+// only written during New, each call builds its own request body, and the
+// optional response cache is internally synchronized.
 type Client struct {
-	apiKey  string
-	model   string
-	baseURL string
-	doer    Doer
+	apiKey        string
+	model         string
+	baseURL       string
+	base          *url.URL // parsed baseURL
+	allowInsecure bool     // permit http:// to loopback hosts
+	doer          Doer
+	safety        []SafetySetting
+
+	// httpClient is the default client created by New. Transport options
+	// only apply while it is still the Doer.
+	httpClient *http.Client
+	ownsClient bool // httpClient is in use, i.e. no custom Doer was supplied
+	// fetchDoer is the supplied Doer (or httpClient) with only the timeout
+	// applied, for downloads that are not API calls.
+	fetchDoer Doer
+	proxyURL  string
+
+	dialTimeout           time.Duration
+	tlsHandshakeTimeout   time.Duration
+	responseHeaderTimeout time.Duration
+
+	// modelInfo holds caller-seeded metadata for the configured model.
+	modelInfo   Model
+	outputLimit int
+
+	defaultMaxTokens      int
+	defaultMaxTokensSet   bool
+	defaultTemperature    float64
+	defaultTemperatureSet bool
+
+	timeout    time.Duration
+	timeoutSet bool
+
+	retries   int
+	retryBase time.Duration
+
+	systemInstruction string
+	systemMerge       string
+	preprocess        func(string) string
+
+	gzipRequests bool
+
+	recordDir string
+	recordSet bool
+	replayDir string
+	replaySet bool
+
+	rateLimitSet bool
+	rateRPS      float64
+	rateBurst    int
+
+	logger      Logger
+	usageLogger UsageLogger
+	clock       clock
+	tracer      Tracer
+	split       *modelSplit
+	cache       *responseCache
+	countCache  *responseCache // token counts; set together with cache
+	usage       *usageTotals
 }
 
+// System instruction merge modes for WithSystemInstructionMerge.
+const (
+	SystemInstructionAppend  = "append"  // client instruction, then per-call instruction
+	SystemInstructionPrefix  = "prefix"  // per-call instruction, then client instruction
+	SystemInstructionReplace = "replace" // per-call instruction replaces the client one
+)
+
 // Option configures a Client.
 type Option func(*Client)
 
-// WithModel sets the model name.
+// WithModel sets the model name, either bare ("gemini-2.5-flash") or
+// prefixed ("models/gemini-2.5-flash"). It must not be empty.
 func WithModel(model string) Option {
 	return func(c *Client) { c.model = model }
 }
@@ -53,66 +181,444 @@ func WithDoer(d Doer) Option {
 	return func(c *Client) { c.doer = d }
 }
 
+// WithHTTPClient sets a preconfigured *http.Client (proxy, TLS, timeouts) as
+// the Doer. It is equivalent to WithDoer(hc).
+func WithHTTPClient(hc *http.Client) Option {
+	return WithDoer(hc)
+}
+
+// WithProxy routes requests through the given HTTP(S) or SOCKS5 proxy URL.
+// It configures the default HTTP client only and has no effect when a Doer is
+// supplied with WithDoer or WithHTTPClient; the URL is validated either way.
+func WithProxy(proxyURL string) Option {
+	return func(c *Client) { c.proxyURL = proxyURL }
+}
+
+// WithTransportTimeouts bounds the phases of a connection on the default HTTP
+// client: dialing, the TLS handshake, and waiting for response headers after
+// the request is written. Zero keeps the default for that phase. Like
+// WithProxy it has no effect when a Doer is supplied with WithDoer or
+// WithHTTPClient.
+func WithTransportTimeouts(dial, tlsHandshake, responseHeader time.Duration) Option {
+	return func(c *Client) {
+		c.dialTimeout = dial
+		c.tlsHandshakeTimeout = tlsHandshake
+		c.responseHeaderTimeout = responseHeader
+	}
+}
+
 // WithBaseURL overrides the API base URL.
 func WithBaseURL(url string) Option {
 	return func(c *Client) { c.baseURL = url }
 }
 
-// WithTimeout sets the timeout on the default HTTP client.
-// Ignored when WithDoer is also used, since the caller controls their own client.
+// WithAllowInsecure permits a plain http:// base URL, for tests against a
+// local mock server. Only loopback hosts (localhost, 127.0.0.0/8, ::1) are
+// accepted, so the API key is never sent unencrypted over a network. Do not
+// use it in production code.
+func WithAllowInsecure() Option {
+	return func(c *Client) { c.allowInsecure = true }
+}
+
+// WithTimeout bounds each HTTP attempt. It sets Timeout on the default HTTP
+// client; with a Doer from WithDoer or WithHTTPClient, each request context is
+// given a deadline instead, leaving the caller's client unmodified. Zero
+// disables the timeout.
 func WithTimeout(d time.Duration) Option {
 	return func(c *Client) {
-		if hc, ok := c.doer.(*http.Client); ok {
-			hc.Timeout = d
-		}
+		c.timeout = d
+		c.timeoutSet = true
+	}
+}
+
+// MaxTemperature returns the maximum temperature accepted by the configured
+// model, if known from the metadata seeded with WithModelInfo.
+func (c *Client) MaxTemperature() (float64, bool) {
+	return c.modelInfo.MaxTemperature, c.modelInfo.MaxTemperature > 0
+}
+
+// WithRetry retries failed requests up to retries times after the initial
+// attempt. Only 429, 5xx, and network errors are retried, using exponential
+// backoff with full jitter from base and honoring Retry-After. A 429 with
+// APIError.QuotaExhausted set is not retried. It wraps any
+// Doer, including one supplied via WithDoer. Don't combine it with a Doer that
+// already retries, such as a call.Client built with call.WithRetry.
+func WithRetry(retries int, base time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.retryBase = base
 	}
 }
 
+// WithDefaultSystemInstruction sets a system instruction sent with every request.
+func WithDefaultSystemInstruction(text string) Option {
+	return func(c *Client) { c.systemInstruction = text }
+}
+
+// WithSystemInstructionMerge controls how a per-call WithSystemInstruction
+// combines with the client-level instruction: SystemInstructionAppend (the
+// default), SystemInstructionPrefix, or SystemInstructionReplace. Each
+// instruction is sent as its own part in the resulting order.
+func WithSystemInstructionMerge(mode string) Option {
+	return func(c *Client) { c.systemMerge = mode }
+}
+
+// WithPromptPreprocessor transforms every prompt passed to Generate,
+// GenerateStreamCallback, CountTokens, and BuildRequest before the request
+// is built, e.g. to scrub PII. The transformed prompt is what is sent and
+// retried; fn runs once per call, not per retry. GenerateContents turns are
+// not preprocessed.
+func WithPromptPreprocessor(fn func(string) string) Option {
+	return func(c *Client) { c.preprocess = fn }
+}
+
+// WithDefaultSafetySettings sets safety settings sent with every request.
+// Per-call WithSafetySettings entries take precedence for the same category;
+// categories not mentioned per call keep the client-level threshold.
+func WithDefaultSafetySettings(settings ...SafetySetting) Option {
+	return func(c *Client) { c.safety = append(c.safety, settings...) }
+}
+
+// WithDefaultMaxTokens sets the max output tokens used when a call does not
+// pass WithMaxTokens or a WithGenerationConfig carrying MaxOutputTokens.
+func WithDefaultMaxTokens(n int) Option {
+	return func(c *Client) {
+		c.defaultMaxTokens = n
+		c.defaultMaxTokensSet = true
+	}
+}
+
+// WithDefaultTemperature sets the temperature used when a call does not pass
+// WithTemperature or a WithGenerationConfig carrying Temperature.
+func WithDefaultTemperature(t float64) Option {
+	return func(c *Client) {
+		c.defaultTemperature = t
+		c.defaultTemperatureSet = true
+	}
+}
+
+// WithModelOutputLimit sets the model's maximum output tokens. Generate then
+// rejects a larger WithMaxTokens before calling the API, and the default max
+// tokens is capped at the limit. It overrides OutputTokenLimit from
+// WithModelInfo regardless of option order.
+func WithModelOutputLimit(n int) Option {
+	return func(c *Client) { c.outputLimit = n }
+}
+
+// WithRequestGzip gzip-compresses request bodies of at least 1 KiB and sets
+// Content-Encoding: gzip, saving bandwidth on large multimodal requests.
+// Smaller bodies are sent as-is to avoid the overhead.
+func WithRequestGzip() Option {
+	return func(c *Client) { c.gzipRequests = true }
+}
+
+// WithRateLimit throttles the client to rps requests per second with bursts
+// of up to burst, blocking each request until a token is available or its
+// context is done. Retry attempts spend tokens too.
+func WithRateLimit(rps float64, burst int) Option {
+	return func(c *Client) {
+		c.rateLimitSet = true
+		c.rateRPS = rps
+		c.rateBurst = burst
+	}
+}
+
+// WithLogger sets a logger for client warnings, such as large inline media.
+// By default nothing is logged.
+func WithLogger(l Logger) Option {
+	return func(c *Client) { c.logger = l }
+}
+
+// WithUsageLogger logs the model and token counts after each successful
+// generation. By default usage is not logged.
+func WithUsageLogger(l UsageLogger) Option {
+	return func(c *Client) { c.usageLogger = l }
+}
+
+// WithCache keeps up to size successful responses in an in-memory LRU cache,
+// keyed by a hash of the model endpoint and serialized request, so identical
+// calls are served without contacting the API. Entries expire after ttl, or
+// never when ttl is zero. Streaming bypasses the cache. countTokens results
+// are kept in a second LRU of the same size and ttl, keyed by the serialized
+// count request, so CountTokens, WithTokenGuard, and SplitByTokens reuse
+// counts for identical prompts, system instructions, and history.
+// Intended for idempotent prompts; sampling options are part of the key.
+func WithCache(size int, ttl time.Duration) Option {
+	return func(c *Client) {
+		c.cache = newResponseCache(size, ttl)
+		c.countCache = newResponseCache(size, ttl)
+	}
+}
+
+// ClearCache removes all cached responses. It is a no-op without WithCache.
+func (c *Client) ClearCache() {
+	if c.cache != nil {
+		c.cache.clear()
+		c.countCache.clear()
+	}
+}
+
+// Close clears the response cache and closes idle connections of the default
+// HTTP client. A Doer supplied by the caller is left untouched. Close is safe
+// to call more than once.
+func (c *Client) Close() error {
+	c.ClearCache()
+	if c.ownsClient {
+		c.httpClient.CloseIdleConnections()
+	}
+	return nil
+}
+
+// WithModelInfo seeds metadata (such as token limits) for the configured model,
+// enabling local checks like FitsContext without a network call.
+func WithModelInfo(m Model) Option {
+	return func(c *Client) { c.modelInfo = m }
+}
+
 // New creates a Gemini client with the given API key and options.
 func New(apiKey string, opts ...Option) (*Client, error) {
 	if strings.TrimSpace(apiKey) == "" {
 		return nil, chassiserrors.ValidationError("gemini: API key must not be empty")
 	}
+	hc := &http.Client{Timeout: defaultTimeout}
 	c := &Client{
-		apiKey:  apiKey,
-		model:   defaultModel,
-		baseURL: defaultBaseURL,
-		doer:    &http.Client{Timeout: defaultTimeout},
+		apiKey:      apiKey,
+		model:       defaultModel,
+		baseURL:     defaultBaseURL,
+		doer:        hc,
+		httpClient:  hc,
+		systemMerge: SystemInstructionAppend,
+		clock:       realClock{},
+		usage:       &usageTotals{},
 	}
 	for _, o := range opts {
 		o(c)
 	}
 	c.baseURL = strings.TrimRight(c.baseURL, "/")
-	if !strings.HasPrefix(c.baseURL, "https://") {
+	insecure := c.allowInsecure && strings.HasPrefix(c.baseURL, "http://")
+	if !strings.HasPrefix(c.baseURL, "https://") && !insecure {
 		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: base URL must use HTTPS, got %q", c.baseURL))
 	}
-	if c.model == "" {
+	base, err := url.Parse(c.baseURL)
+	if err != nil || base.Host == "" {
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: invalid base URL %q", c.baseURL))
+	}
+	if insecure && !isLoopbackHost(base.Hostname()) {
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: WithAllowInsecure only permits loopback hosts, got %q", base.Host))
+	}
+	c.base = base
+	if strings.TrimSpace(c.model) == "" {
 		return nil, chassiserrors.ValidationError("gemini: model must not be empty")
 	}
 	if !validModel.MatchString(c.model) {
 		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: invalid model name %q", c.model))
 	}
+	if s := c.split; s != nil {
+		for _, m := range []string{s.modelA, s.modelB} {
+			if !validModel.MatchString(m) {
+				return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: invalid model name %q in model split", m))
+			}
+		}
+		if !(s.ratioA >= 0 && s.ratioA <= 1) {
+			return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: model split ratio must be between 0 and 1, got %g", s.ratioA))
+		}
+	}
+	switch c.systemMerge {
+	case SystemInstructionAppend, SystemInstructionPrefix, SystemInstructionReplace:
+	default:
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: invalid system instruction merge mode %q", c.systemMerge))
+	}
+	if c.proxyURL != "" {
+		u, err := url.Parse(c.proxyURL)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: invalid proxy URL %q", c.proxyURL))
+		}
+		if t := c.ownedTransport(); t != nil {
+			t.Proxy = http.ProxyURL(u)
+		}
+	}
+	if c.dialTimeout < 0 || c.tlsHandshakeTimeout < 0 || c.responseHeaderTimeout < 0 {
+		return nil, chassiserrors.ValidationError("gemini: transport timeouts must not be negative")
+	}
+	if c.dialTimeout > 0 || c.tlsHandshakeTimeout > 0 || c.responseHeaderTimeout > 0 {
+		if t := c.ownedTransport(); t != nil {
+			if c.dialTimeout > 0 {
+				t.DialContext = (&net.Dialer{Timeout: c.dialTimeout, KeepAlive: 30 * time.Second}).DialContext
+			}
+			if c.tlsHandshakeTimeout > 0 {
+				t.TLSHandshakeTimeout = c.tlsHandshakeTimeout
+			}
+			if c.responseHeaderTimeout > 0 {
+				t.ResponseHeaderTimeout = c.responseHeaderTimeout
+			}
+		}
+	}
+	if c.outputLimit < 0 {
+		return nil, chassiserrors.ValidationError("gemini: model output limit must not be negative")
+	}
+	if c.outputLimit > 0 {
+		c.modelInfo.OutputTokenLimit = c.outputLimit
+	}
+	if c.defaultMaxTokensSet {
+		if c.defaultMaxTokens <= 0 || c.defaultMaxTokens > maxMaxTokens {
+			return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: default maxTokens must be between 1 and %d, got %d", maxMaxTokens, c.defaultMaxTokens))
+		}
+		if limit := c.modelInfo.OutputTokenLimit; limit > 0 && c.defaultMaxTokens > limit {
+			return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: default maxTokens %d exceeds model output limit %d", c.defaultMaxTokens, limit))
+		}
+	}
+	if c.defaultTemperatureSet && (c.defaultTemperature < 0 || c.defaultTemperature > maxTemperature) {
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: default temperature must be between 0 and %.1f, got %f", maxTemperature, c.defaultTemperature))
+	}
+	if c.cache != nil && (c.cache.size <= 0 || c.cache.ttl < 0) {
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: cache size must be positive and TTL not negative, got %d and %v", c.cache.size, c.cache.ttl))
+	}
+	if c.timeout < 0 {
+		return nil, chassiserrors.ValidationError("gemini: timeout must not be negative")
+	}
+	c.ownsClient = c.doer == Doer(c.httpClient)
+	c.fetchDoer = c.doer
+	if c.recordSet && c.replaySet {
+		return nil, chassiserrors.ValidationError("gemini: WithRecorder and WithReplay are mutually exclusive")
+	}
+	if (c.recordSet && c.recordDir == "") || (c.replaySet && c.replayDir == "") {
+		return nil, chassiserrors.ValidationError("gemini: recording directory must not be empty")
+	}
+	if c.recordSet {
+		c.doer = &recordDoer{next: c.doer, dir: c.recordDir}
+	}
+	if c.replaySet {
+		c.doer = &replayDoer{dir: c.replayDir}
+	}
+	if c.timeoutSet {
+		if c.ownsClient {
+			c.httpClient.Timeout = c.timeout
+		} else if c.timeout > 0 {
+			c.doer = &timeoutDoer{next: c.doer, timeout: c.timeout}
+			c.fetchDoer = &timeoutDoer{next: c.fetchDoer, timeout: c.timeout}
+		}
+	}
+	if c.rateLimitSet {
+		if !(c.rateRPS > 0) || math.IsInf(c.rateRPS, 1) || c.rateBurst < 1 {
+			return nil, chassiserrors.ValidationError("gemini: rate limit must be positive with a burst of at least 1")
+		}
+		c.doer = newRateLimitDoer(c.doer, c.clock, c.rateRPS, c.rateBurst)
+	}
+	if c.retries < 0 || c.retryBase < 0 {
+		return nil, chassiserrors.ValidationError("gemini: retry count and base delay must not be negative")
+	}
+	if c.retries > 0 {
+		c.doer = &retryDoer{next: c.doer, retries: c.retries, base: c.retryBase, clock: c.clock}
+	}
 
 	return c, nil
 }
 
+// ownedTransport returns the transport of the default HTTP client, creating
+// it from http.DefaultTransport on first use. It returns nil when the caller
+// supplied their own Doer.
+func (c *Client) ownedTransport() *http.Transport {
+	if c.doer != Doer(c.httpClient) {
+		return nil
+	}
+	if t, ok := c.httpClient.Transport.(*http.Transport); ok {
+		return t
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	c.httpClient.Transport = t
+	return t
+}
+
 // GenerateOption configures a single Generate call.
 type GenerateOption func(*generateConfig)
 
 type generateConfig struct {
-	maxTokens    int
-	temperature  float64
-	googleSearch bool
+	maxTokens       int
+	maxTokensSet    bool
+	unlimitedTokens bool
+	temperature     float64
+	temperatureSet  bool
+	googleSearch    bool
+	searchFallback  bool
+	functions       []FunctionDeclaration
+	toolConfig      *ToolConfig
+	safety          []SafetySetting
+	safetyThreshold string
+	modalities      []string
+	system          string
+	labels          map[string]string
+	parts           []Part
+	mimeType        string
+	schema          *Schema
+	jsonCheck       func(offset int, err error)
+	requestID       string
+	model           string
+	tokenGuard      int
+	retryOnEmpty    int
+	validator       func(*Response) error
+	logprobs        int
+	logprobsSet     bool
+	audioTimestamp  bool
+	topP            *float64
+	topK            *int
+	seed            *int
+	stop            []string
+	metadataOnly    bool
+	candidates      int
+	streamIdle      time.Duration
+	rawSink         io.Writer
+	callTimeout     time.Duration
+
+	// base holds WithGenerationConfig values, applied where no WithX
+	// option set the same field.
+	base *GenerationConfig
+
+	validateOptions   bool
+	errorOnSafety     bool
+	errorOnRecitation bool
+	strictFeedback    bool
+
+	// err records the first invalid option, reported by newGenerateConfig.
+	err error
 }
 
 // WithMaxTokens sets the max output tokens for a request.
 func WithMaxTokens(n int) GenerateOption {
-	return func(g *generateConfig) { g.maxTokens = n }
+	return func(g *generateConfig) {
+		g.maxTokens = n
+		g.maxTokensSet = true
+		g.unlimitedTokens = false
+	}
+}
+
+// WithUnlimitedTokens omits maxOutputTokens from the request so the model's
+// own default output limit applies. It overrides WithDefaultMaxTokens and a
+// WithGenerationConfig baseline; a later WithMaxTokens overrides it.
+func WithUnlimitedTokens() GenerateOption {
+	return func(g *generateConfig) {
+		g.maxTokens = 0
+		g.maxTokensSet = true
+		g.unlimitedTokens = true
+	}
 }
 
 // WithTemperature sets the temperature for a request.
 func WithTemperature(t float64) GenerateOption {
-	return func(g *generateConfig) { g.temperature = t }
+	return func(g *generateConfig) {
+		g.temperature = t
+		g.temperatureSet = true
+	}
+}
+
+// WithGenerationConfig seeds the request from a reusable baseline config.
+// Individual options always take precedence over it, regardless of order:
+// WithMaxTokens, WithTemperature, WithResponseModalities, WithJSONOutput,
+// WithCandidateCount, WithResponseSchema, WithLogprobs, WithTopP, WithTopK,
+// WithSeed, and WithStopSequences override the matching field. Unset (zero
+// or nil) fields are ignored. A later WithGenerationConfig replaces an
+// earlier one.
+func WithGenerationConfig(gc GenerationConfig) GenerateOption {
+	return func(g *generateConfig) { g.base = &gc }
 }
 
 // WithGoogleSearch enables grounding with Google Search.
@@ -120,95 +626,1171 @@ func WithGoogleSearch() GenerateOption {
 	return func(g *generateConfig) { g.googleSearch = true }
 }
 
+// WithGoogleSearchFallback enables grounding with Google Search like
+// WithGoogleSearch, but if the model rejects the tool with a 400 the call is
+// retried once without it and Response.SearchFallback is set. Streaming calls
+// do not fall back.
+func WithGoogleSearchFallback() GenerateOption {
+	return func(g *generateConfig) {
+		g.googleSearch = true
+		g.searchFallback = true
+	}
+}
+
+// WithValidateOptions checks the request options against the model metadata
+// seeded with WithModelInfo (such as MaxTemperature) before sending. Checks
+// are skipped for fields the metadata does not provide.
+func WithValidateOptions() GenerateOption {
+	return func(g *generateConfig) { g.validateOptions = true }
+}
+
+// WithLabels tags the request with billing labels (e.g. team or project) for
+// cost attribution. Keys and values are validated against the API limits.
+func WithLabels(labels map[string]string) GenerateOption {
+	return func(g *generateConfig) {
+		if g.labels == nil {
+			g.labels = make(map[string]string, len(labels))
+		}
+		for k, v := range labels {
+			g.labels[k] = v
+		}
+	}
+}
+
+// WithAudio attaches audio (e.g. "audio/wav", "audio/mp3") as an inline-data
+// part after the prompt, for transcription or understanding. The MIME type
+// must start with "audio/". A warning is logged via WithLogger when inline
+// data approaches the request size limit; use the File API for long audio.
+func WithAudio(mimeType string, data []byte) GenerateOption {
+	return func(g *generateConfig) {
+		if !strings.HasPrefix(mimeType, "audio/") {
+			g.fail(chassiserrors.ValidationError(fmt.Sprintf("gemini: audio MIME type must start with \"audio/\", got %q", mimeType)))
+			return
+		}
+		g.parts = append(g.parts, NewInlineDataPart(mimeType, data))
+	}
+}
+
+// WithPDF attaches a PDF document as an inline-data part after the prompt.
+// Documents whose base64 encoding exceeds the 20 MB inline limit are
+// rejected; upload those with the File API and attach them with WithFile.
+func WithPDF(data []byte) GenerateOption {
+	return func(g *generateConfig) {
+		if len(data) == 0 {
+			g.fail(chassiserrors.ValidationError("gemini: PDF data must not be empty"))
+			return
+		}
+		if n := base64.StdEncoding.EncodedLen(len(data)); n > maxInlineBytes {
+			g.fail(chassiserrors.ValidationError(fmt.Sprintf("gemini: PDF is %d bytes encoded, over the %d byte inline limit; upload it with the File API and use WithFile", n, maxInlineBytes)))
+			return
+		}
+		g.parts = append(g.parts, NewInlineDataPart("application/pdf", data))
+	}
+}
+
+// WithParts attaches arbitrary parts, such as one from FetchImagePart, after
+// the prompt.
+func WithParts(parts ...Part) GenerateOption {
+	return func(g *generateConfig) { g.parts = append(g.parts, parts...) }
+}
+
+// WithFile attaches media previously uploaded via the File API, referenced by
+// its URI, after the prompt.
+func WithFile(uri, mimeType string) GenerateOption {
+	return func(g *generateConfig) {
+		if strings.TrimSpace(uri) == "" {
+			g.fail(chassiserrors.ValidationError("gemini: file URI must not be empty"))
+			return
+		}
+		g.parts = append(g.parts, Part{FileData: &FileData{MimeType: mimeType, FileURI: uri}})
+	}
+}
+
+// VideoOption configures the clip and sampling of a WithVideoFile part.
+type VideoOption func(*VideoMetadata)
+
+// WithVideoStartOffset starts the clip at d into the video.
+func WithVideoStartOffset(d time.Duration) VideoOption {
+	return func(m *VideoMetadata) { m.StartOffset = formatOffset(d) }
+}
+
+// WithVideoEndOffset ends the clip at d into the video.
+func WithVideoEndOffset(d time.Duration) VideoOption {
+	return func(m *VideoMetadata) { m.EndOffset = formatOffset(d) }
+}
+
+// WithVideoFPS sets the frame sampling rate, in (0, 24]. The API default is 1.
+func WithVideoFPS(fps float64) VideoOption {
+	return func(m *VideoMetadata) { m.FPS = fps }
+}
+
+// WithVideoFile attaches a video uploaded via the File API, like WithFile.
+// VideoOptions add a videoMetadata block to the part; without them the whole
+// video is sampled at the API default rate.
+func WithVideoFile(uri, mimeType string, opts ...VideoOption) GenerateOption {
+	return func(g *generateConfig) {
+		if !strings.HasPrefix(mimeType, "video/") {
+			g.fail(chassiserrors.ValidationError(fmt.Sprintf("gemini: video MIME type must start with \"video/\", got %q", mimeType)))
+			return
+		}
+		WithFile(uri, mimeType)(g)
+		if g.err != nil || len(opts) == 0 {
+			return
+		}
+		var meta VideoMetadata
+		for _, o := range opts {
+			o(&meta)
+		}
+		if meta.FPS < 0 || meta.FPS > maxVideoFPS {
+			g.fail(chassiserrors.ValidationError(fmt.Sprintf("gemini: video FPS must be between 0 and %g, got %g", float64(maxVideoFPS), meta.FPS)))
+			return
+		}
+		g.parts[len(g.parts)-1].VideoMetadata = &meta
+	}
+}
+
+// formatOffset renders d in the API's duration form: seconds with an "s" suffix.
+func formatOffset(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+// fail records err unless an earlier option already failed.
+func (g *generateConfig) fail(err error) {
+	if g.err == nil {
+		g.err = err
+	}
+}
+
+// WithJSONOutput asks the model to respond with JSON
+// (responseMimeType "application/json").
+func WithJSONOutput() GenerateOption {
+	return func(g *generateConfig) { g.mimeType = "application/json" }
+}
+
+// WithResponseSchema constrains the JSON response to schema and implies
+// WithJSONOutput.
+func WithResponseSchema(schema *Schema) GenerateOption {
+	return func(g *generateConfig) {
+		g.schema = schema
+		g.mimeType = "application/json"
+	}
+}
+
+// WithStreamJSONCheck makes GenerateStreamCallback check the JSON streamed so
+// far after every chunk when JSON output is requested, calling onInvalid once
+// with the approximate byte offset where the text first stops being a valid
+// JSON prefix or, with WithResponseSchema, first diverges from the schema's
+// property names and types. The check is best-effort and does not stop the stream; an
+// incomplete but valid prefix is never reported.
+func WithStreamJSONCheck(onInvalid func(offset int, err error)) GenerateOption {
+	return func(g *generateConfig) { g.jsonCheck = onInvalid }
+}
+
+// WithTopP sets nucleus sampling: tokens are drawn from the smallest set
+// whose cumulative probability reaches p, between 0 and 1.
+func WithTopP(p float64) GenerateOption {
+	return func(g *generateConfig) { g.topP = &p }
+}
+
+// WithTopK limits sampling to the k most likely tokens at each step.
+func WithTopK(k int) GenerateOption {
+	return func(g *generateConfig) { g.topK = &k }
+}
+
+// WithSeed fixes the sampling seed so repeated requests are more likely to
+// produce the same output. Determinism is best-effort.
+func WithSeed(seed int) GenerateOption {
+	return func(g *generateConfig) { g.seed = &seed }
+}
+
+// WithStopSequences stops generation at the first occurrence of any of up to
+// five sequences. The sequence itself is not included in the response.
+func WithStopSequences(seqs ...string) GenerateOption {
+	return func(g *generateConfig) { g.stop = seqs }
+}
+
+// WithLogprobs asks for the log-probability of each generated token, read
+// with Candidate.TokenLogprobs. A topN between 1 and 20 also returns that many
+// most likely alternatives per token; 0 returns only the chosen tokens.
+func WithLogprobs(topN int) GenerateOption {
+	return func(g *generateConfig) {
+		g.logprobs = topN
+		g.logprobsSet = true
+	}
+}
+
+// WithAudioTimestamp asks the model to include timestamps when it
+// transcribes or describes audio parts of the request.
+func WithAudioTimestamp() GenerateOption {
+	return func(g *generateConfig) { g.audioTimestamp = true }
+}
+
+// WithCandidateCount requests n alternative completions, between 1 and 8.
+// Response.Text reads the first; iterate Response.Candidates for the rest.
+func WithCandidateCount(n int) GenerateOption {
+	return func(g *generateConfig) { g.candidates = n }
+}
+
+// WithStreamRawSink copies each raw "data:" line of a GenerateStreamCallback
+// response to w, newline-terminated, before it is parsed, for debugging.
+// Write errors are ignored and parsing is unaffected. Ignored by Generate.
+func WithStreamRawSink(w io.Writer) GenerateOption {
+	return func(g *generateConfig) { g.rawSink = w }
+}
+
+// WithStreamIdleTimeout aborts GenerateStreamCallback with ErrStreamIdle when
+// no line arrives for d, independently of the overall context deadline. SSE
+// keepalive comments count as lines, so a slow but live stream is kept. It
+// guards against stalled or half-open connections. Ignored by Generate.
+func WithStreamIdleTimeout(d time.Duration) GenerateOption {
+	return func(g *generateConfig) { g.streamIdle = d }
+}
+
+// WithCallTimeout bounds each attempt of this call by d, overriding nothing
+// else: the client's WithTimeout still applies, so the shorter deadline wins.
+// With WithRetry, every attempt gets its own d. The call as a whole is
+// bounded by EstimateMaxDuration(d, retries, base) for each request sequence
+// it can issue: one per generation attempt under WithRetryOnEmpty, doubled by
+// WithGoogleSearchFallback, plus the WithTokenGuard counts, so retries are
+// not cut short. Pass the overall deadline, if any, in the context given to
+// Generate. Ignored by GenerateStreamCallback.
+func WithCallTimeout(d time.Duration) GenerateOption {
+	return func(g *generateConfig) { g.callTimeout = d }
+}
+
+// WithErrorOnSafety makes Generate return a *SafetyError instead of the
+// response when the first candidate finishes with reason SAFETY.
+func WithErrorOnSafety() GenerateOption {
+	return func(g *generateConfig) { g.errorOnSafety = true }
+}
+
+// WithErrorOnRecitation makes Generate return a *ResponseError wrapping
+// ErrRecitation instead of the response when the first candidate finishes
+// with reason RECITATION. The error's Candidate holds that candidate.
+func WithErrorOnRecitation() GenerateOption {
+	return func(g *generateConfig) { g.errorOnRecitation = true }
+}
+
+// WithStrictPromptFeedback makes Generate return a *ResponseError wrapping
+// ErrBlocked when the response carries a promptFeedback block reason, even if
+// it also contains candidates. By default such responses are returned as is.
+func WithStrictPromptFeedback() GenerateOption {
+	return func(g *generateConfig) { g.strictFeedback = true }
+}
+
+// checkFinishReason enforces WithStrictPromptFeedback, WithErrorOnSafety, and
+// WithErrorOnRecitation.
+func checkFinishReason(resp *Response, cfg *generateConfig) error {
+	if reason := resp.blockReason(); cfg.strictFeedback && reason != "" {
+		return &ResponseError{Err: fmt.Errorf("%w: %s", ErrBlocked, reason), Response: resp}
+	}
+	if len(resp.Candidates) == 0 {
+		return nil
+	}
+	switch cand := &resp.Candidates[0]; {
+	case cfg.errorOnSafety && cand.FinishReason == FinishReasonSafety:
+		return newSafetyError(resp)
+	case cfg.errorOnRecitation && cand.FinishReason == FinishReasonRecitation:
+		return &ResponseError{Err: ErrRecitation, Response: resp, Candidate: cand}
+	}
+	return nil
+}
+
+// WithTokenGuard calls countTokens before generating and fails with
+// ErrPromptTooLarge, without the generation call, if the request's prompt
+// tokens exceed maxPromptTokens. It costs one extra round trip per call.
+func WithTokenGuard(maxPromptTokens int) GenerateOption {
+	return func(g *generateConfig) { g.tokenGuard = maxPromptTokens }
+}
+
+// WithRetryOnEmpty re-issues the request up to attempts more times when the
+// API answers with no candidates and no block reason, or when a
+// WithResponseValidator rejects the response, instead of failing straight
+// away. Retries stop once ctx is done.
+func WithRetryOnEmpty(attempts int) GenerateOption {
+	return func(g *generateConfig) { g.retryOnEmpty = attempts }
+}
+
+// WithResponseValidator runs validate on each parsed response before it is
+// returned. A non-nil error fails the call with a *ResponseError wrapping it.
+// With WithRetryOnEmpty, a rejected response is retried like an empty one.
+// Cached responses are validated too, and rejected ones are not cached.
+// Streaming calls are not validated.
+func WithResponseValidator(validate func(*Response) error) GenerateOption {
+	return func(g *generateConfig) { g.validator = validate }
+}
+
+// WithMetadataOnly keeps only the first 256 bytes of each candidate's text,
+// dropping the rest after the body is read, while UsageMetadata, finish
+// reasons, and safety ratings are kept. Use it when a call is made for its
+// usage or outcome and large outputs should not be retained in memory.
+// Cached responses are stored in full.
+func WithMetadataOnly() GenerateOption {
+	return func(g *generateConfig) { g.metadataOnly = true }
+}
+
+// WithRequestModel calls model instead of the client's model for this
+// request. It takes precedence over a model set with ContextWithModel.
+// WithModelInfo metadata is not applied to the overriding model.
+func WithRequestModel(model string) GenerateOption {
+	return func(g *generateConfig) { g.model = model }
+}
+
+// modelKey is the context key for ContextWithModel.
+type modelKey struct{}
+
+// ContextWithModel returns a copy of ctx that makes calls using it target
+// model, e.g. from request-scoped middleware. Precedence is WithRequestModel,
+// then the context, then the client's model.
+func ContextWithModel(ctx context.Context, model string) context.Context {
+	return context.WithValue(ctx, modelKey{}, model)
+}
+
+// ModelFromContext returns the model set with ContextWithModel, if any.
+func ModelFromContext(ctx context.Context) (string, bool) {
+	model, ok := ctx.Value(modelKey{}).(string)
+	return model, ok && model != ""
+}
+
+// WithRequestID sends id in the x-request-id header for tracing across
+// services. The server's own correlation ID is returned in Response.ResponseID.
+func WithRequestID(id string) GenerateOption {
+	return func(g *generateConfig) {
+		if strings.ContainsAny(id, "\r\n") {
+			g.fail(chassiserrors.ValidationError("gemini: request ID must not contain line breaks"))
+			return
+		}
+		g.requestID = id
+	}
+}
+
+// WithSystemInstruction sets a system instruction for a request. How it
+// combines with a client-level instruction is set by WithSystemInstructionMerge.
+func WithSystemInstruction(text string) GenerateOption {
+	return func(g *generateConfig) { g.system = text }
+}
+
+// WithResponseModalities sets the output modalities to request, e.g.
+// WithResponseModalities(ModalityText, ModalityImage) for image-capable models.
+func WithResponseModalities(modalities ...string) GenerateOption {
+	return func(g *generateConfig) { g.modalities = modalities }
+}
+
+// WithSafetySettings sets safety settings for a request, overriding the
+// client-level defaults for the same categories.
+func WithSafetySettings(settings ...SafetySetting) GenerateOption {
+	return func(g *generateConfig) { g.safety = append(g.safety, settings...) }
+}
+
+// WithSafetyThreshold applies threshold, one of the HarmBlock constants, to
+// every known harm category. Per-category WithSafetySettings entries take
+// precedence over it regardless of order, and it takes precedence over
+// client-level defaults.
+func WithSafetyThreshold(threshold string) GenerateOption {
+	return func(g *generateConfig) { g.safetyThreshold = threshold }
+}
+
+// WithFunctionDeclarations exposes functions the model may call.
+func WithFunctionDeclarations(decls ...FunctionDeclaration) GenerateOption {
+	return func(g *generateConfig) { g.functions = append(g.functions, decls...) }
+}
+
+// WithToolConfig sets the tool configuration, e.g. to force or disable function calling.
+func WithToolConfig(tc ToolConfig) GenerateOption {
+	return func(g *generateConfig) { g.toolConfig = &tc }
+}
+
 // Generate sends a prompt to the Gemini API and returns the parsed response.
+// A successful response with no candidates and no block reason yields a
+// *ResponseError wrapping ErrNoCandidates.
 func (c *Client) Generate(ctx context.Context, prompt string, opts ...GenerateOption) (*Response, error) {
+	return c.generate(ctx, c.userTurn(prompt), opts)
+}
+
+// GenerateSimple is Generate for scripts that do not manage contexts. It
+// bounds the call by the client's timeout (30s by default, see WithTimeout),
+// stretched to cover any WithRetry attempts and backoff, and returns only
+// the first candidate's text. API errors are returned as from Generate.
+func (c *Client) GenerateSimple(prompt string, opts ...GenerateOption) (string, error) {
+	ctx := context.Background()
+	timeout := defaultTimeout
+	if c.timeoutSet {
+		timeout = c.timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, EstimateMaxDuration(timeout, c.retries, c.retryBase))
+		defer cancel()
+	}
+	resp, err := c.Generate(ctx, prompt, opts...)
+	if err != nil {
+		return "", err
+	}
+	return resp.Text(), nil
+}
+
+// BuildRequest returns the request body Generate would send for prompt and
+// opts, without calling the API. All option validation still runs, so it
+// suits snapshot tests and debugging option interactions.
+func (c *Client) BuildRequest(prompt string, opts ...GenerateOption) (*Request, error) {
+	cfg, err := c.newGenerateConfig(context.Background(), opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.forModel(cfg.model).buildRequest(c.userTurn(prompt), cfg), nil
+}
+
+// GenerateFromJSON posts body to the generateContent endpoint byte for byte
+// and parses the result, for request fields the typed Request does not model
+// yet. A marshaled BuildRequest result is a convenient starting point. Body
+// must be valid JSON; no GenerateOptions, caching, or candidate checks apply.
+// Usage is added to TotalUsage like any other generate call.
+func (c *Client) GenerateFromJSON(ctx context.Context, body json.RawMessage) (*Response, error) {
+	if !json.Valid(body) {
+		return nil, chassiserrors.ValidationError("gemini: request body is not valid JSON")
+	}
+	var resp Response
+	if err := c.doRequest(ctx, "generateContent", nil, body, &resp, ""); err != nil {
+		return nil, err
+	}
+	c.recordUsage(&resp)
+	return &resp, nil
+}
+
+// promptContents wraps a single prompt as a user turn.
+func promptContents(prompt string) []Content {
+	return []Content{
+		{Role: RoleUser, Parts: []Part{{Text: prompt}}},
+	}
+}
+
+// userTurn applies the WithPromptPreprocessor hook, if any, to prompt and
+// wraps the result as a user turn.
+func (c *Client) userTurn(prompt string) []Content {
+	if c.preprocess != nil {
+		prompt = c.preprocess(prompt)
+	}
+	return promptContents(prompt)
+}
+
+// GenerateContents sends a multi-turn conversation to the Gemini API. Use it to
+// reply to a function call: include the model's functionCall turn followed by a
+// content with role "function" (or "tool") holding NewFunctionResponsePart.
+func (c *Client) GenerateContents(ctx context.Context, contents []Content, opts ...GenerateOption) (*Response, error) {
+	if err := validateContents(contents); err != nil {
+		return nil, err
+	}
+	return c.generate(ctx, contents, opts)
+}
+
+// generate applies and validates the options, then performs the request.
+func (c *Client) generate(ctx context.Context, contents []Content, opts []GenerateOption) (*Response, error) {
+	cfg, err := c.newGenerateConfig(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.callTimeout > 0 {
+		var cancel context.CancelFunc
+		budget := EstimateMaxDuration(cfg.callTimeout, c.retries, c.retryBase) * time.Duration(cfg.requestSequences())
+		ctx, cancel = context.WithTimeout(withAttemptTimeout(ctx, cfg.callTimeout), budget)
+		defer cancel()
+	}
+	return c.forModel(cfg.model).generateViaHTTP(ctx, contents, cfg)
+}
+
+// requestSequences returns how many retried request sequences generateViaHTTP
+// can issue for g: each generation attempt and the token guard count, all
+// repeated by the search fallback.
+func (g *generateConfig) requestSequences() int {
+	n := 1 + g.retryOnEmpty
+	guards := 0
+	if g.tokenGuard > 0 {
+		guards = 1
+	}
+	if g.searchFallback {
+		n *= 2
+		guards *= 2
+	}
+	return n + guards
+}
+
+// newGenerateConfig applies opts over the defaults and validates the result.
+// It resolves the call's model from WithRequestModel, then ctx (see
+// ContextWithModel), then WithModelSplit, then the client; run the call on
+// c.forModel(cfg.model).
+func (c *Client) newGenerateConfig(ctx context.Context, opts []GenerateOption) (*generateConfig, error) {
 	cfg := &generateConfig{
 		maxTokens:   32000,
 		temperature: 1.0,
 	}
+	if c.defaultMaxTokensSet {
+		cfg.maxTokens = c.defaultMaxTokens
+	}
+	if c.defaultTemperatureSet {
+		cfg.temperature = c.defaultTemperature
+	}
 	for _, o := range opts {
 		o(cfg)
 	}
+	if cfg.err != nil {
+		return nil, cfg.err
+	}
+	cfg.applyBase()
 
-	if cfg.maxTokens <= 0 || cfg.maxTokens > maxMaxTokens {
+	if cfg.model == "" {
+		cfg.model, _ = ModelFromContext(ctx)
+	}
+	if cfg.model == "" && c.split != nil {
+		cfg.model = c.split.pick()
+	}
+	if cfg.model == "" {
+		cfg.model = c.model
+	} else if !validModel.MatchString(cfg.model) {
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: invalid model name %q", cfg.model))
+	}
+	info := c.forModel(cfg.model).modelInfo
+
+	limit := info.OutputTokenLimit
+	if limit > 0 && !cfg.maxTokensSet {
+		cfg.maxTokens = min(cfg.maxTokens, limit)
+	}
+	if !cfg.unlimitedTokens && (cfg.maxTokens <= 0 || cfg.maxTokens > maxMaxTokens) {
 		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: maxTokens must be between 1 and %d, got %d", maxMaxTokens, cfg.maxTokens))
 	}
 	if cfg.temperature < 0 || cfg.temperature > maxTemperature {
 		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: temperature must be between 0 and %.1f, got %f", maxTemperature, cfg.temperature))
 	}
+	if limit > 0 && cfg.maxTokens > limit {
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: maxTokens %d exceeds model output limit %d", cfg.maxTokens, limit))
+	}
+	if err := validateToolConfig(cfg.toolConfig); err != nil {
+		return nil, err
+	}
+	if cfg.candidates < 0 || cfg.candidates > maxCandidateCount {
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: candidate count must be between 1 and %d, got %d", maxCandidateCount, cfg.candidates))
+	}
+	if cfg.logprobs < 0 || cfg.logprobs > maxLogprobs {
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: logprobs must be between 0 and %d, got %d", maxLogprobs, cfg.logprobs))
+	}
+	if cfg.topP != nil && (*cfg.topP < 0 || *cfg.topP > 1) {
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: topP must be between 0 and 1, got %g", *cfg.topP))
+	}
+	if cfg.topK != nil && *cfg.topK < 1 {
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: topK must be at least 1, got %d", *cfg.topK))
+	}
+	if len(cfg.stop) > maxStopSequences {
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: at most %d stop sequences are allowed, got %d", maxStopSequences, len(cfg.stop)))
+	}
+	if slices.Contains(cfg.stop, "") {
+		return nil, chassiserrors.ValidationError("gemini: stop sequences must not be empty")
+	}
+	if cfg.streamIdle < 0 {
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: stream idle timeout must not be negative, got %v", cfg.streamIdle))
+	}
+	if cfg.callTimeout < 0 {
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: call timeout must not be negative, got %v", cfg.callTimeout))
+	}
+	if cfg.retryOnEmpty < 0 {
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: retry-on-empty attempts must not be negative, got %d", cfg.retryOnEmpty))
+	}
+	if cfg.tokenGuard < 0 {
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: token guard must not be negative, got %d", cfg.tokenGuard))
+	}
+	switch cfg.safetyThreshold {
+	case "", HarmBlockNone, HarmBlockOnlyHigh, HarmBlockMediumAndAbove, HarmBlockLowAndAbove, HarmBlockOff:
+	default:
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: invalid safety threshold %q", cfg.safetyThreshold))
+	}
+	if err := validateLabels(cfg.labels); err != nil {
+		return nil, err
+	}
+	for _, m := range cfg.modalities {
+		switch m {
+		case ModalityText, ModalityImage, ModalityAudio:
+		default:
+			return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: invalid response modality %q", m))
+		}
+	}
+	if cfg.validateOptions {
+		if maxTemp := info.MaxTemperature; maxTemp > 0 && cfg.temperature > maxTemp {
+			return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: temperature %g exceeds model maximum %g", cfg.temperature, maxTemp))
+		}
+	}
+	return cfg, nil
+}
+
+// forModel returns c, or for a different model a shallow copy of c that
+// calls that model. The copy carries no model metadata from WithModelInfo,
+// which describes the client's own model.
+func (c *Client) forModel(model string) *Client {
+	if model == c.model {
+		return c
+	}
+	cp := *c
+	cp.model = model
+	cp.modelInfo = Model{}
+	return &cp
+}
 
-	return c.generateViaHTTP(ctx, prompt, cfg)
+// isLoopbackHost reports whether host names the local machine.
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// applyBase fills fields not set by individual options from the
+// WithGenerationConfig baseline.
+func (g *generateConfig) applyBase() {
+	b := g.base
+	if b == nil {
+		return
+	}
+	if !g.maxTokensSet && b.MaxOutputTokens != 0 {
+		g.maxTokens = b.MaxOutputTokens
+		g.maxTokensSet = true
+	}
+	if !g.temperatureSet && b.Temperature != nil {
+		g.temperature = *b.Temperature
+	}
+	if g.modalities == nil {
+		g.modalities = b.ResponseModalities
+	}
+	if g.mimeType == "" {
+		g.mimeType = b.ResponseMimeType
+	}
+	if g.candidates == 0 {
+		g.candidates = b.CandidateCount
+	}
+	if g.schema == nil {
+		g.schema = b.ResponseSchema
+	}
+	if g.topP == nil {
+		g.topP = b.TopP
+	}
+	if g.topK == nil {
+		g.topK = b.TopK
+	}
+	if g.seed == nil {
+		g.seed = b.Seed
+	}
+	if g.stop == nil {
+		g.stop = b.StopSequences
+	}
+	if b.AudioTimestamp {
+		g.audioTimestamp = true
+	}
+	if !g.logprobsSet && b.ResponseLogprobs {
+		g.logprobs = b.Logprobs
+		g.logprobsSet = true
+	}
+}
+
+// validateContents checks that a conversation is non-empty and uses known roles.
+func validateContents(contents []Content) error {
+	if len(contents) == 0 {
+		return chassiserrors.ValidationError("gemini: contents must not be empty")
+	}
+	for i, ct := range contents {
+		switch ct.Role {
+		case RoleUser, RoleModel, RoleFunction, RoleTool:
+		default:
+			return chassiserrors.ValidationError(fmt.Sprintf("gemini: contents[%d]: invalid role %q", i, ct.Role))
+		}
+		if len(ct.Parts) == 0 {
+			return chassiserrors.ValidationError(fmt.Sprintf("gemini: contents[%d]: parts must not be empty", i))
+		}
+	}
+	return nil
+}
+
+// validateToolConfig checks the function calling mode and allowed names.
+func validateToolConfig(tc *ToolConfig) error {
+	if tc == nil || tc.FunctionCallingConfig == nil {
+		return nil
+	}
+	fc := tc.FunctionCallingConfig
+	switch fc.Mode {
+	case "", FunctionCallingAuto, FunctionCallingAny, FunctionCallingNone:
+	default:
+		return chassiserrors.ValidationError(fmt.Sprintf("gemini: invalid function calling mode %q", fc.Mode))
+	}
+	if len(fc.AllowedFunctionNames) > 0 && fc.Mode != FunctionCallingAny {
+		return chassiserrors.ValidationError("gemini: allowed function names require function calling mode ANY")
+	}
+	return nil
+}
+
+// validateLabels checks label count and key/value format.
+func validateLabels(labels map[string]string) error {
+	if len(labels) > maxLabels {
+		return chassiserrors.ValidationError(fmt.Sprintf("gemini: at most %d labels allowed, got %d", maxLabels, len(labels)))
+	}
+	for k, v := range labels {
+		if !validLabelKey.MatchString(k) {
+			return chassiserrors.ValidationError(fmt.Sprintf("gemini: invalid label key %q: must start with a lowercase letter and use at most 63 lowercase letters, digits, '_' or '-'", k))
+		}
+		if !validLabelValue.MatchString(v) {
+			return chassiserrors.ValidationError(fmt.Sprintf("gemini: invalid value for label %q: must use at most 63 lowercase letters, digits, '_' or '-'", k))
+		}
+	}
+	return nil
+}
+
+// mergeSafetySettings overlays per-call settings on the client defaults by
+// category. Defaults keep their order; new categories are appended.
+func mergeSafetySettings(defaults, overrides []SafetySetting) []SafetySetting {
+	if len(overrides) == 0 {
+		return defaults
+	}
+	merged := make([]SafetySetting, 0, len(defaults)+len(overrides))
+	index := make(map[string]int, len(defaults)+len(overrides))
+	for _, s := range append(append([]SafetySetting(nil), defaults...), overrides...) {
+		if i, ok := index[s.Category]; ok {
+			merged[i] = s
+			continue
+		}
+		index[s.Category] = len(merged)
+		merged = append(merged, s)
+	}
+	return merged
 }
 
 // generateViaHTTP sends the request to Gemini's native generateContent API.
-func (c *Client) generateViaHTTP(ctx context.Context, prompt string, cfg *generateConfig) (*Response, error) {
-	reqBody := Request{
-		Contents: []Content{
-			{Role: "user", Parts: []Part{{Text: prompt}}},
-		},
+func (c *Client) generateViaHTTP(ctx context.Context, contents []Content, cfg *generateConfig) (*Response, error) {
+	reqBody := c.buildRequest(contents, cfg)
+	guardErr := c.checkTokenGuard(ctx, reqBody, cfg)
+	var resp *Response
+	err := guardErr
+	if err == nil {
+		resp, err = c.fetch(ctx, reqBody, cfg)
+	}
+	fallback := err != nil && cfg.searchFallback && searchUnsupported(err)
+	if fallback {
+		noSearch := *cfg
+		noSearch.googleSearch = false
+		if guardErr == nil {
+			// The count with the search tool passed, and the request
+			// without it is no larger, so the guard is not rerun.
+			noSearch.tokenGuard = 0
+		}
+		reqBody = c.buildRequest(contents, &noSearch)
+		if err = c.checkTokenGuard(ctx, reqBody, &noSearch); err == nil {
+			resp, err = c.fetch(ctx, reqBody, &noSearch)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp.Model = c.model
+	resp.SearchFallback = fallback
+	if cfg.metadataOnly {
+		truncateCandidateText(resp, metadataOnlyTextBytes)
+	}
+	if err := checkFinishReason(resp, cfg); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// searchUnsupported reports whether err is a 400 rejecting the Google Search
+// tool, e.g. "Search Grounding is not supported".
+func searchUnsupported(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	msg := strings.ToLower(apiErr.Message)
+	return (strings.Contains(msg, "search") || strings.Contains(msg, "grounding")) &&
+		(strings.Contains(msg, "not supported") || strings.Contains(msg, "unsupported") || strings.Contains(msg, "not enabled"))
+}
+
+// truncateCandidateText keeps at most limit bytes of each candidate's text,
+// cut at a rune boundary, and drops the text parts beyond it. Kept text is
+// copied so the full decoded strings can be freed.
+func truncateCandidateText(resp *Response, limit int) {
+	for i := range resp.Candidates {
+		budget := limit
+		parts := resp.Candidates[i].Content.Parts[:0]
+		for _, p := range resp.Candidates[i].Content.Parts {
+			if p.Text != "" {
+				if len(p.Text) > budget {
+					n := budget
+					for n > 0 && !utf8.RuneStart(p.Text[n]) {
+						n--
+					}
+					p.Text = p.Text[:n]
+					budget = 0
+				} else {
+					budget -= len(p.Text)
+				}
+				if p.Text == "" {
+					continue
+				}
+				p.Text = strings.Clone(p.Text)
+			}
+			parts = append(parts, p)
+		}
+		resp.Candidates[i].Content.Parts = parts
+	}
+}
+
+// fetch returns the response for reqBody from the cache or the API.
+func (c *Client) fetch(ctx context.Context, reqBody *Request, cfg *generateConfig) (*Response, error) {
+	var key string
+	if c.cache != nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var err error
+		if key, err = cacheKey(c.endpoint("generateContent", nil), reqBody); err != nil {
+			return nil, fmt.Errorf("gemini: marshal request: %w", err)
+		}
+		if resp, ok := c.cache.get(key, c.clock.Now()); ok && cfg.validate(resp) == nil {
+			return resp, nil
+		}
+	}
+	var resp Response
+	for attempt := 0; ; attempt++ {
+		resp = Response{}
+		if err := c.doRequest(ctx, "generateContent", nil, reqBody, &resp, cfg.requestID); err != nil {
+			return nil, err
+		}
+		var err error
+		if len(resp.Candidates) == 0 && resp.blockReason() == "" {
+			err = ErrNoCandidates
+		} else if err = cfg.validate(&resp); err == nil {
+			break
+		}
+		if attempt >= cfg.retryOnEmpty {
+			return nil, &ResponseError{Err: err, Response: &resp}
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	c.recordUsage(&resp)
+	if c.cache != nil {
+		c.cache.put(key, &resp, c.clock.Now())
+	}
+	return &resp, nil
+}
+
+// validate runs the WithResponseValidator hook, if any, on resp.
+func (g *generateConfig) validate(resp *Response) error {
+	if g.validator == nil {
+		return nil
+	}
+	if err := g.validator(resp); err != nil {
+		return fmt.Errorf("gemini: response rejected by validator: %w", err)
+	}
+	return nil
+}
+
+// recordUsage adds a successful response's token usage to the client totals
+// and reports it to the usage logger.
+func (c *Client) recordUsage(resp *Response) {
+	c.usage.add(resp.UsageMetadata)
+	if c.usageLogger == nil {
+		return
+	}
+	u := resp.UsageMetadata
+	c.usageLogger.Info("gemini: token usage",
+		"model", c.model,
+		"prompt_tokens", u.PromptTokenCount,
+		"candidate_tokens", u.CandidatesTokenCount,
+		"total_tokens", u.TotalTokenCount)
+}
+
+// buildRequest assembles the request body from validated options.
+func (c *Client) buildRequest(contents []Content, cfg *generateConfig) *Request {
+	reqBody := &Request{
+		SystemInstruction: c.mergeSystemInstruction(cfg.system),
+		Contents:          appendParts(contents, cfg.parts),
 		GenerationConfig: GenerationConfig{
-			MaxOutputTokens: cfg.maxTokens,
-			Temperature:     &cfg.temperature,
+			MaxOutputTokens:    cfg.maxTokens,
+			Temperature:        &cfg.temperature,
+			ResponseModalities: cfg.modalities,
+			ResponseMimeType:   cfg.mimeType,
+			CandidateCount:     cfg.candidates,
+			ResponseSchema:     cfg.schema,
+			ResponseLogprobs:   cfg.logprobsSet,
+			Logprobs:           cfg.logprobs,
+			TopP:               cfg.topP,
+			TopK:               cfg.topK,
+			Seed:               cfg.seed,
+			StopSequences:      cfg.stop,
+			AudioTimestamp:     cfg.audioTimestamp,
 		},
 	}
 
 	if cfg.googleSearch {
-		reqBody.Tools = []Tool{{GoogleSearch: &GoogleSearch{}}}
+		reqBody.Tools = append(reqBody.Tools, Tool{GoogleSearch: &GoogleSearch{}})
+	}
+	if len(cfg.functions) > 0 {
+		reqBody.Tools = append(reqBody.Tools, Tool{FunctionDeclarations: cfg.functions})
 	}
+	reqBody.ToolConfig = cfg.toolConfig
+	safety := c.safety
+	if cfg.safetyThreshold != "" {
+		all := make([]SafetySetting, len(harmCategories))
+		for i, cat := range harmCategories {
+			all[i] = SafetySetting{Category: cat, Threshold: cfg.safetyThreshold}
+		}
+		safety = mergeSafetySettings(safety, all)
+	}
+	reqBody.SafetySettings = mergeSafetySettings(safety, cfg.safety)
+	reqBody.Labels = cfg.labels
+	c.warnInlineSize(cfg.parts, cfg.requestID)
+	return reqBody
+}
 
-	var resp Response
-	if err := c.doRequest(ctx, &reqBody, &resp); err != nil {
-		return nil, err
+// appendParts adds extra parts to the final user turn, or as a new user turn
+// when the conversation ends with another role. contents is not modified.
+func appendParts(contents []Content, parts []Part) []Content {
+	if len(parts) == 0 {
+		return contents
 	}
-	return &resp, nil
+	out := slices.Clone(contents)
+	if n := len(out); n > 0 && out[n-1].Role == RoleUser {
+		out[n-1].Parts = append(slices.Clip(out[n-1].Parts), parts...)
+		return out
+	}
+	return append(out, Content{Role: RoleUser, Parts: parts})
 }
 
-// doRequest performs an HTTP request to the Gemini API.
-func (c *Client) doRequest(ctx context.Context, reqBody, respBody any) error {
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return fmt.Errorf("gemini: marshal request: %w", err)
+// warnInlineSize logs a warning when the encoded inline data in parts
+// approaches the API request size limit.
+func (c *Client) warnInlineSize(parts []Part, requestID string) {
+	if c.logger == nil {
+		return
+	}
+	size := 0
+	for _, p := range parts {
+		if p.InlineData != nil {
+			size += len(p.InlineData.Data)
+		}
 	}
+	if size >= inlineWarnBytes {
+		args := []any{"inline_bytes", size, "limit_bytes", maxInlineBytes}
+		if requestID != "" {
+			args = append(args, "request_id", requestID)
+		}
+		c.logger.Warn("gemini: inline data approaches the request size limit; upload large media with the File API instead", args...)
+	}
+}
 
-	url := fmt.Sprintf("%s/%s:generateContent", c.baseURL, c.model)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jsonData))
-	if err != nil {
-		return fmt.Errorf("gemini: create request: %w", err)
+// mergeSystemInstruction combines the client and per-call system instructions
+// according to the client's merge mode. Returns nil when neither is set.
+func (c *Client) mergeSystemInstruction(perCall string) *Content {
+	var texts []string
+	switch {
+	case perCall == "":
+		texts = []string{c.systemInstruction}
+	case c.systemMerge == SystemInstructionReplace:
+		texts = []string{perCall}
+	case c.systemMerge == SystemInstructionPrefix:
+		texts = []string{perCall, c.systemInstruction}
+	default:
+		texts = []string{c.systemInstruction, perCall}
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-goog-api-key", c.apiKey)
+	var parts []Part
+	for _, t := range texts {
+		if t != "" {
+			parts = append(parts, Part{Text: t})
+		}
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	return &Content{Parts: parts}
+}
 
-	// Allow retry middleware to replay the body on subsequent attempts.
-	req.GetBody = func() (io.ReadCloser, error) {
-		return io.NopCloser(bytes.NewReader(jsonData)), nil
+// doRequest calls the model method (e.g. "generateContent" or "countTokens")
+// with optional query parameters. The body is decoded as JSON into respBody,
+// or copied raw when respBody is a *[]byte (e.g. for alt=media). When respBody
+// is a *Response, its ResponseID is taken from the x-goog-request-id header
+// and its Attempts from the retry wrapper.
+func (c *Client) doRequest(ctx context.Context, method string, query url.Values, reqBody, respBody any, requestID string) (err error) {
+	var status int
+	if c.tracer != nil {
+		var span Span
+		ctx, span = c.tracer.Start(ctx, "gemini."+method)
+		defer func() { c.endSpan(span, status, respBody, err) }()
 	}
 
+	jsonData, ok := reqBody.(json.RawMessage)
+	if !ok {
+		if jsonData, err = json.Marshal(reqBody); err != nil {
+			return fmt.Errorf("gemini: marshal request: %w", err)
+		}
+	}
+
+	req, err := c.newRequest(ctx, c.endpoint(method, query), jsonData, requestID)
+	if err != nil {
+		return err
+	}
+	status, err = c.send(req, respBody)
+	return c.modelNotFound(err)
+}
+
+// send executes req and decodes a successful body into respBody, which may
+// be a *[]byte to receive the raw body. Error statuses become a dependency
+// error caused by *APIError. It returns the HTTP status code, or 0 when no
+// response arrived.
+func (c *Client) send(req *http.Request, respBody any) (int, error) {
+	attempts := 1
+	if _, ok := respBody.(*Response); ok && c.retries > 0 {
+		req = req.WithContext(context.WithValue(req.Context(), attemptsKey{}, &attempts))
+	}
 	resp, err := c.doer.Do(req)
 	if err != nil {
-		return chassiserrors.DependencyError(fmt.Sprintf("gemini: do request: %v", err)).WithCause(err)
+		return 0, chassiserrors.DependencyError(fmt.Sprintf("gemini: do request: %v", err)).WithCause(err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes+1))
 	if err != nil {
-		return chassiserrors.DependencyError(fmt.Sprintf("gemini: read response: %v", err)).WithCause(err)
+		return resp.StatusCode, chassiserrors.DependencyError(fmt.Sprintf("gemini: read response: %v", err)).WithCause(err)
 	}
 	if len(body) > maxResponseBytes {
-		return chassiserrors.DependencyError(fmt.Sprintf("gemini: response exceeds %d byte limit", maxResponseBytes))
+		return resp.StatusCode, chassiserrors.DependencyError(fmt.Sprintf("gemini: response exceeds %d byte limit", maxResponseBytes))
 	}
 
 	if resp.StatusCode >= 400 {
-		msg := string(body)
-		if len(msg) > maxErrorBodyBytes {
-			msg = msg[:maxErrorBodyBytes] + "...(truncated)"
-		}
-		return chassiserrors.DependencyError(fmt.Sprintf("gemini: HTTP %d: %s", resp.StatusCode, msg))
+		return resp.StatusCode, httpError(resp.StatusCode, body)
 	}
 
+	if raw, ok := respBody.(*[]byte); ok {
+		*raw = body
+		return resp.StatusCode, nil
+	}
 	if err := json.Unmarshal(body, respBody); err != nil {
-		return fmt.Errorf("gemini: unmarshal response: %w", err)
+		return resp.StatusCode, fmt.Errorf("gemini: unmarshal response: %w", err)
+	}
+	if r, ok := respBody.(*Response); ok {
+		r.ResponseID = resp.Header.Get(responseIDHeader)
+		r.Attempts = attempts
 	}
 
-	return nil
+	return resp.StatusCode, nil
+}
+
+// ParseResponse decodes a raw generateContent response body, such as one
+// captured from logs or a queue, with the same size limit and unmarshaling a
+// Client applies. ResponseID is left empty since it comes from a header.
+func ParseResponse(data []byte) (*Response, error) {
+	if len(data) > maxResponseBytes {
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: response exceeds %d byte limit", maxResponseBytes))
+	}
+	var resp Response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("gemini: unmarshal response: %w", err)
+	}
+	return &resp, nil
+}
+
+// endpoint returns the URL of a model method, such as
+// ".../models/gemini-x:generateContent?alt=sse". Path segments are joined
+// and escaped by net/url rather than concatenated.
+func (c *Client) endpoint(method string, query url.Values) string {
+	u := c.base.JoinPath(c.modelPath() + ":" + method)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// modelPath returns the model's URL path segment. Both bare names and
+// "models/..." names are accepted; the prefix is dropped when the base URL
+// already ends in /models so it is not doubled.
+func (c *Client) modelPath() string {
+	if strings.HasSuffix(c.baseURL, "/models") {
+		return strings.TrimPrefix(c.model, "models/")
+	}
+	return c.model
+}
+
+// newRequest builds an authenticated JSON POST request to endpoint, tagged
+// with requestID when it is set.
+func (c *Client) newRequest(ctx context.Context, endpoint string, jsonData []byte, requestID string) (*http.Request, error) {
+	gzipped := c.gzipRequests && len(jsonData) >= gzipMinBytes
+	if gzipped {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(jsonData); err != nil {
+			return nil, fmt.Errorf("gemini: compress request: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("gemini: compress request: %w", err)
+		}
+		jsonData = buf.Bytes()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("gemini: create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	req.Header.Set("x-goog-api-key", c.apiKey)
+	if requestID != "" {
+		req.Header.Set(requestIDHeader, requestID)
+	}
+
+	// Allow retry middleware to replay the (possibly compressed) body on
+	// subsequent attempts.
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(jsonData)), nil
+	}
+	return req, nil
+}
+
+// httpError converts an HTTP error status and body into a dependency error
+// caused by an *APIError.
+func httpError(status int, body []byte) error {
+	apiErr := newAPIError(status, body)
+	return chassiserrors.DependencyError(apiErr.Error()).WithCause(apiErr)
+}
+
+// modelNotFound wraps err with ErrModelNotFound and the client's model name
+// when it is a 404 NOT_FOUND about the model; other errors pass through.
+func (c *Client) modelNotFound(err error) error {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound &&
+		apiErr.Status == "NOT_FOUND" && strings.Contains(strings.ToLower(apiErr.Message), "model") {
+		return fmt.Errorf("%w %q: %w", ErrModelNotFound, c.model, err)
+	}
+	return err
+}
+
+// newAPIError parses the Google JSON error envelope, falling back to the
+// truncated raw body as the message when the body is not in that form.
+func newAPIError(status int, body []byte) *APIError {
+	var envelope struct {
+		Error struct {
+			Message string            `json:"message"`
+			Status  string            `json:"status"`
+			Details []json.RawMessage `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Error.Message != "" {
+		return &APIError{
+			StatusCode: status,
+			Status:     envelope.Error.Status,
+			Message:    envelope.Error.Message,
+			Details:    envelope.Error.Details,
+			QuotaExhausted: status == http.StatusTooManyRequests &&
+				quotaExhausted(envelope.Error.Details),
+		}
+	}
+	msg := string(body)
+	if len(msg) > maxErrorBodyBytes {
+		msg = msg[:maxErrorBodyBytes] + "...(truncated)"
+	}
+	return &APIError{StatusCode: status, Message: msg}
 }
@@ -1,21 +1,36 @@
 package gemini
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode/utf8"
 )
 
+// okBody is a minimal successful response with a single text candidate.
+const okBody = `{"candidates":[{"content":{"role":"model","parts":[{"text":"ok"}]},"finishReason":"STOP"}]}`
+
 // mockDoer captures the request and returns a canned response.
 type mockDoer struct {
 	req        *http.Request
 	body       []byte
 	statusCode int
 	respBody   string
+	header     http.Header
 	err        error
 }
 
@@ -29,6 +44,7 @@ func (m *mockDoer) Do(req *http.Request) (*http.Response, error) {
 	}
 	return &http.Response{
 		StatusCode: m.statusCode,
+		Header:     m.header,
 		Body:       io.NopCloser(strings.NewReader(m.respBody)),
 	}, nil
 }
@@ -79,6 +95,36 @@ func TestNew_HTTPBaseURL(t *testing.T) {
 	}
 }
 
+func TestNew_AllowInsecure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, okBody)
+	}))
+	defer srv.Close()
+
+	if _, err := New("key", WithBaseURL(srv.URL)); err == nil || !strings.Contains(err.Error(), "HTTPS") {
+		t.Fatalf("without WithAllowInsecure: got %v, want HTTPS error", err)
+	}
+
+	c, err := New("key", WithBaseURL(srv.URL), WithAllowInsecure())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.Generate(context.Background(), "test"); err != nil {
+		t.Fatalf("generate against local server: %v", err)
+	}
+
+	for _, u := range []string{"http://localhost:8080", "http://[::1]:8080", "https://example.com"} {
+		if _, err := New("key", WithBaseURL(u), WithAllowInsecure()); err != nil {
+			t.Errorf("%s: unexpected error: %v", u, err)
+		}
+	}
+	for _, u := range []string{"http://example.com", "http://10.0.0.1", "ftp://localhost"} {
+		if _, err := New("key", WithBaseURL(u), WithAllowInsecure()); err == nil {
+			t.Errorf("%s: expected error", u)
+		}
+	}
+}
+
 func TestNew_WithOptions(t *testing.T) {
 	mock := &mockDoer{}
 	c, err := New("key",
@@ -107,7 +153,7 @@ func mustNew(t *testing.T, apiKey string, opts ...Option) *Client {
 }
 
 func TestGenerate_RequestBuilding(t *testing.T) {
-	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
 	c := mustNew(t, "my-api-key", WithDoer(mock), WithModel("test-model"), WithBaseURL("https://api.test"))
 
 	_, _ = c.Generate(context.Background(), "hello world",
@@ -153,8 +199,30 @@ func TestGenerate_RequestBuilding(t *testing.T) {
 	}
 }
 
+func TestGenerate_PromptRoleUser(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock), WithDefaultSystemInstruction("be brief"))
+
+	if _, err := c.Generate(context.Background(), "hello"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var raw struct {
+		SystemInstruction map[string]json.RawMessage   `json:"systemInstruction"`
+		Contents          []map[string]json.RawMessage `json:"contents"`
+	}
+	if err := json.Unmarshal(mock.body, &raw); err != nil {
+		t.Fatalf("unmarshal request body: %v", err)
+	}
+	if len(raw.Contents) != 1 || string(raw.Contents[0]["role"]) != `"user"` {
+		t.Errorf("contents role: got %s", mock.body)
+	}
+	if _, ok := raw.SystemInstruction["role"]; ok {
+		t.Errorf("system instruction should omit an empty role: %s", mock.body)
+	}
+}
+
 func TestGenerate_NoGoogleSearch(t *testing.T) {
-	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
 	c := mustNew(t, "key", WithDoer(mock))
 
 	_, _ = c.Generate(context.Background(), "test")
@@ -168,6 +236,83 @@ func TestGenerate_NoGoogleSearch(t *testing.T) {
 	}
 }
 
+func TestGenerate_GoogleSearchFallback(t *testing.T) {
+	const unsupported = `{"error":{"code":400,"status":"INVALID_ARGUMENT","message":"Search Grounding is not supported."}}`
+	tests := map[string]struct {
+		firstStatus  int
+		firstBody    string
+		wantErr      bool
+		wantFallback bool
+		wantCalls    int
+	}{
+		"supported":       {200, okBody, false, false, 1},
+		"unsupported":     {400, unsupported, false, true, 2},
+		"other 400":       {400, `{"error":{"code":400,"message":"Invalid JSON payload"}}`, true, false, 1},
+		"unsupported 5xx": {500, unsupported, true, false, 1},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var tools []int
+			doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+				var body Request
+				if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+					t.Fatalf("decode request: %v", err)
+				}
+				tools = append(tools, len(body.Tools))
+				status, respBody := tt.firstStatus, tt.firstBody
+				if len(tools) > 1 {
+					status, respBody = 200, okBody
+				}
+				return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(respBody))}, nil
+			})
+			c := mustNew(t, "key", WithDoer(doer))
+
+			resp, err := c.Generate(context.Background(), "test", WithGoogleSearchFallback())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error: got %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(tools) != tt.wantCalls {
+				t.Fatalf("calls: got %d, want %d", len(tools), tt.wantCalls)
+			}
+			if tools[0] != 1 || (len(tools) > 1 && tools[1] != 0) {
+				t.Errorf("tools per call: got %v", tools)
+			}
+			if err == nil && resp.SearchFallback != tt.wantFallback {
+				t.Errorf("SearchFallback: got %v, want %v", resp.SearchFallback, tt.wantFallback)
+			}
+		})
+	}
+}
+
+func TestGenerate_GoogleSearchFallbackGuardsOnce(t *testing.T) {
+	const unsupported = `{"error":{"code":400,"status":"INVALID_ARGUMENT","message":"Search Grounding is not supported."}}`
+	var calls []string
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		_, method, _ := strings.Cut(req.URL.Path, ":")
+		calls = append(calls, method)
+		status, body := 200, okBody
+		switch {
+		case method == "countTokens":
+			body = `{"totalTokens":42}`
+		case len(calls) == 2:
+			status, body = 400, unsupported
+		}
+		return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body))}, nil
+	})
+	c := mustNew(t, "key", WithDoer(doer))
+
+	resp, err := c.Generate(context.Background(), "test", WithGoogleSearchFallback(), WithTokenGuard(100))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.SearchFallback {
+		t.Error("expected SearchFallback")
+	}
+	if want := "countTokens,generateContent,generateContent"; strings.Join(calls, ",") != want {
+		t.Errorf("calls: got %v, want %s", calls, want)
+	}
+}
+
 func TestGenerate_Success(t *testing.T) {
 	respJSON := `{
 		"candidates": [{
@@ -257,7 +402,7 @@ func TestResponse_TextMultipleParts(t *testing.T) {
 }
 
 func TestGenerate_NegativeMaxTokens(t *testing.T) {
-	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
 	c := mustNew(t, "key", WithDoer(mock))
 	_, err := c.Generate(context.Background(), "test", WithMaxTokens(-1))
 	if err == nil {
@@ -266,7 +411,7 @@ func TestGenerate_NegativeMaxTokens(t *testing.T) {
 }
 
 func TestGenerate_NegativeTemperature(t *testing.T) {
-	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
 	c := mustNew(t, "key", WithDoer(mock))
 	_, err := c.Generate(context.Background(), "test", WithTemperature(-0.5))
 	if err == nil {
@@ -274,11 +419,37 @@ func TestGenerate_NegativeTemperature(t *testing.T) {
 	}
 }
 
+func TestWithPromptPreprocessor(t *testing.T) {
+	email := regexp.MustCompile(`\S+@\S+`)
+	calls := 0
+	scrub := func(p string) string {
+		calls++
+		return email.ReplaceAllString(p, "[email]")
+	}
+	doer := &statusDoer{statuses: []int{500, 200}}
+	c := mustNew(t, "key", WithDoer(doer), WithRetry(1, time.Millisecond), WithPromptPreprocessor(scrub))
+
+	if _, err := c.Generate(context.Background(), "mail jo@example.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("preprocessor calls: got %d, want 1", calls)
+	}
+	if len(doer.bodies) != 2 {
+		t.Fatalf("attempts: got %d, want 2", len(doer.bodies))
+	}
+	for i, body := range doer.bodies {
+		if !strings.Contains(body, `"text":"mail [email]"`) || strings.Contains(body, "example.com") {
+			t.Errorf("attempt %d body not preprocessed: %s", i, body)
+		}
+	}
+}
+
 func TestGenerate_ContextPropagated(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
 	c := mustNew(t, "key", WithDoer(mock))
 
 	_, _ = c.Generate(ctx, "test")
@@ -289,7 +460,7 @@ func TestGenerate_ContextPropagated(t *testing.T) {
 }
 
 func TestGenerate_GetBody(t *testing.T) {
-	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
 	c := mustNew(t, "key", WithDoer(mock))
 
 	_, _ = c.Generate(context.Background(), "test")
@@ -330,7 +501,7 @@ func TestNew_WhitespaceOnlyAPIKey(t *testing.T) {
 }
 
 func TestGenerate_ZeroMaxTokens(t *testing.T) {
-	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
 	c := mustNew(t, "key", WithDoer(mock))
 	_, err := c.Generate(context.Background(), "test", WithMaxTokens(0))
 	if err == nil {
@@ -339,7 +510,7 @@ func TestGenerate_ZeroMaxTokens(t *testing.T) {
 }
 
 func TestGenerate_ZeroTemperature(t *testing.T) {
-	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
 	c := mustNew(t, "key", WithDoer(mock))
 	resp, err := c.Generate(context.Background(), "test", WithTemperature(0.0))
 	if err != nil {
@@ -360,6 +531,38 @@ func TestNew_EmptyModel(t *testing.T) {
 	}
 }
 
+func TestNew_WhitespaceModel(t *testing.T) {
+	_, err := New("key", WithModel(" \t "))
+	if err == nil || !strings.Contains(err.Error(), "model must not be empty") {
+		t.Fatalf("expected empty model error, got %v", err)
+	}
+}
+
+func TestGenerate_ModelsPrefixNotDoubled(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantURL string
+	}{
+		{"bare name, default base", nil, defaultBaseURL + "/gemini-2.0-flash:generateContent"},
+		{"prefixed name, default base", []Option{WithModel("models/gemini-2.0-flash")}, defaultBaseURL + "/gemini-2.0-flash:generateContent"},
+		{"prefixed name, version base", []Option{WithModel("models/gemini-2.0-flash"), WithBaseURL("https://api.test/v1beta")}, "https://api.test/v1beta/models/gemini-2.0-flash:generateContent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockDoer{statusCode: 200, respBody: okBody}
+			opts := append([]Option{WithDoer(mock), WithModel("gemini-2.0-flash")}, tt.opts...)
+			c := mustNew(t, "key", opts...)
+
+			_, _ = c.Generate(context.Background(), "test")
+
+			if got := mock.req.URL.String(); got != tt.wantURL {
+				t.Errorf("URL: got %q, want %q", got, tt.wantURL)
+			}
+		})
+	}
+}
+
 func TestNew_InvalidModelName(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -401,7 +604,7 @@ func TestNew_ValidModelNames(t *testing.T) {
 }
 
 func TestGenerate_TemperatureTooHigh(t *testing.T) {
-	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
 	c := mustNew(t, "key", WithDoer(mock))
 	_, err := c.Generate(context.Background(), "test", WithTemperature(2.5))
 	if err == nil {
@@ -413,7 +616,7 @@ func TestGenerate_TemperatureTooHigh(t *testing.T) {
 }
 
 func TestGenerate_MaxTokensTooHigh(t *testing.T) {
-	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
 	c := mustNew(t, "key", WithDoer(mock))
 	_, err := c.Generate(context.Background(), "test", WithMaxTokens(2_000_000))
 	if err == nil {
@@ -425,7 +628,7 @@ func TestGenerate_MaxTokensTooHigh(t *testing.T) {
 }
 
 func TestGenerate_RoleSetToUser(t *testing.T) {
-	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
 	c := mustNew(t, "key", WithDoer(mock))
 
 	_, _ = c.Generate(context.Background(), "test")
@@ -533,7 +736,7 @@ func TestGenerationConfig_TemperatureZeroIncluded(t *testing.T) {
 
 func TestGenerate_TemperatureZeroInRequest(t *testing.T) {
 	// Verify that WithTemperature(0.0) serializes temperature in the request body.
-	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
 	c := mustNew(t, "key", WithDoer(mock))
 
 	_, _ = c.Generate(context.Background(), "test", WithTemperature(0.0))
@@ -547,7 +750,7 @@ func TestGenerate_TemperatureZeroInRequest(t *testing.T) {
 // --- URL construction ---
 
 func TestGenerate_ModelWithSpecialChars(t *testing.T) {
-	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
 	c := mustNew(t, "key", WithDoer(mock), WithModel("models/gemini-2.0-flash"))
 
 	_, _ = c.Generate(context.Background(), "test")
@@ -580,8 +783,37 @@ func TestResponse_TextNilReceiver(t *testing.T) {
 	}
 }
 
+func TestGenerate_BaseURLSlashNormalization(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		want    string
+	}{
+		{"default", "", "https://generativelanguage.googleapis.com/v1beta/models/m:generateContent"},
+		{"no slash", "https://example.com/api", "https://example.com/api/m:generateContent"},
+		{"trailing slash", "https://example.com/api/", "https://example.com/api/m:generateContent"},
+		{"repeated slashes", "https://example.com/api//", "https://example.com/api/m:generateContent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockDoer{statusCode: 200, respBody: okBody}
+			opts := []Option{WithDoer(mock), WithModel("m")}
+			if tt.baseURL != "" {
+				opts = append(opts, WithBaseURL(tt.baseURL))
+			}
+			c := mustNew(t, "key", opts...)
+			if _, err := c.Generate(context.Background(), "test"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := mock.req.URL.String(); got != tt.want {
+				t.Errorf("URL: got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestNew_BaseURLTrailingSlash(t *testing.T) {
-	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
 	c := mustNew(t, "key", WithDoer(mock), WithBaseURL("https://example.com/api/"))
 
 	if strings.HasSuffix(c.baseURL, "/") {
@@ -610,22 +842,116 @@ func TestWithTimeout(t *testing.T) {
 	}
 }
 
-func TestWithTimeout_IgnoredWithCustomDoer(t *testing.T) {
-	mock := &mockDoer{}
-	// WithTimeout applied after WithDoer — should be silently ignored.
-	c, err := New("key", WithDoer(mock), WithTimeout(5*time.Second))
+// deadlineDoer records the deadline of each request context and, when block
+// is set, waits for the context to end.
+type deadlineDoer struct {
+	deadline time.Time
+	hasDL    bool
+	block    bool
+}
+
+func (d *deadlineDoer) Do(req *http.Request) (*http.Response, error) {
+	d.deadline, d.hasDL = req.Context().Deadline()
+	if d.block {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	}
+	return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(okBody))}, nil
+}
+
+func TestWithTimeout_CustomDoerDeadline(t *testing.T) {
+	for _, order := range []string{"doer first", "timeout first"} {
+		t.Run(order, func(t *testing.T) {
+			doer := &deadlineDoer{}
+			opts := []Option{WithDoer(doer), WithTimeout(5 * time.Second)}
+			if order == "timeout first" {
+				opts[0], opts[1] = opts[1], opts[0]
+			}
+			c := mustNew(t, "key", opts...)
+
+			start := time.Now()
+			if _, err := c.Generate(context.Background(), "test"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !doer.hasDL {
+				t.Fatal("request context should have a deadline")
+			}
+			end := time.Now()
+			if doer.deadline.Before(start.Add(5*time.Second)) || doer.deadline.After(end.Add(5*time.Second)) {
+				t.Errorf("deadline %v, want 5s after the request started", doer.deadline.Sub(start))
+			}
+		})
+	}
+}
+
+func TestWithTimeout_CustomDoerExpires(t *testing.T) {
+	doer := &deadlineDoer{block: true}
+	c := mustNew(t, "key", WithDoer(doer), WithTimeout(10*time.Millisecond))
+
+	_, err := c.Generate(context.Background(), "test")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestGenerateSimple(t *testing.T) {
+	doer := &deadlineDoer{}
+	c := mustNew(t, "key", WithDoer(doer))
+
+	start := time.Now()
+	text, err := c.GenerateSimple("test")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if c.doer != mock {
-		t.Error("doer should still be the custom mock")
+	if text != "ok" {
+		t.Errorf("text: got %q, want ok", text)
+	}
+	if !doer.hasDL || doer.deadline.Before(start.Add(defaultTimeout)) || doer.deadline.After(time.Now().Add(defaultTimeout)) {
+		t.Errorf("deadline: got %v (set=%v), want about %v from now", doer.deadline, doer.hasDL, defaultTimeout)
+	}
+}
+
+func TestGenerateSimple_APIError(t *testing.T) {
+	mock := &mockDoer{statusCode: 400, respBody: `{"error":{"code":400,"message":"bad prompt","status":"INVALID_ARGUMENT"}}`}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	text, err := c.GenerateSimple("test")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Message != "bad prompt" {
+		t.Fatalf("expected *APIError, got %v", err)
+	}
+	if text != "" {
+		t.Errorf("text: got %q, want empty", text)
+	}
+}
+
+func TestGenerateSimple_Timeout(t *testing.T) {
+	doer := &deadlineDoer{block: true}
+	c := mustNew(t, "key", WithDoer(doer), WithTimeout(10*time.Millisecond))
+
+	if _, err := c.GenerateSimple("test"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestWithTimeout_CustomHTTPClientUnmodified(t *testing.T) {
+	hc := &http.Client{Timeout: time.Minute}
+	mustNew(t, "key", WithHTTPClient(hc), WithTimeout(5*time.Second))
+	if hc.Timeout != time.Minute {
+		t.Errorf("caller's client timeout changed to %v", hc.Timeout)
+	}
+}
+
+func TestWithTimeout_Negative(t *testing.T) {
+	if _, err := New("key", WithTimeout(-time.Second)); err == nil {
+		t.Fatal("expected error for negative timeout")
 	}
 }
 
 // --- Boundary value tests ---
 
 func TestGenerate_MaxTokensBoundaryLow(t *testing.T) {
-	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
 	c := mustNew(t, "key", WithDoer(mock))
 	_, err := c.Generate(context.Background(), "test", WithMaxTokens(1))
 	if err != nil {
@@ -634,7 +960,7 @@ func TestGenerate_MaxTokensBoundaryLow(t *testing.T) {
 }
 
 func TestGenerate_MaxTokensBoundaryHigh(t *testing.T) {
-	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
 	c := mustNew(t, "key", WithDoer(mock))
 	_, err := c.Generate(context.Background(), "test", WithMaxTokens(1_000_000))
 	if err != nil {
@@ -643,7 +969,7 @@ func TestGenerate_MaxTokensBoundaryHigh(t *testing.T) {
 }
 
 func TestGenerate_MaxTokensJustOverBoundary(t *testing.T) {
-	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
 	c := mustNew(t, "key", WithDoer(mock))
 	_, err := c.Generate(context.Background(), "test", WithMaxTokens(1_000_001))
 	if err == nil {
@@ -651,8 +977,29 @@ func TestGenerate_MaxTokensJustOverBoundary(t *testing.T) {
 	}
 }
 
+func TestGenerate_UnlimitedTokens(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock), WithDefaultMaxTokens(100))
+
+	_, err := c.Generate(context.Background(), "test", WithGenerationConfig(GenerationConfig{MaxOutputTokens: 50}), WithUnlimitedTokens())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(mock.body), "maxOutputTokens") {
+		t.Errorf("maxOutputTokens should be absent: %s", mock.body)
+	}
+
+	_, _ = c.Generate(context.Background(), "test", WithUnlimitedTokens(), WithMaxTokens(10))
+	if !strings.Contains(string(mock.body), `"maxOutputTokens":10`) {
+		t.Errorf("a later WithMaxTokens should win: %s", mock.body)
+	}
+	if _, err := c.Generate(context.Background(), "test", WithMaxTokens(0)); err == nil {
+		t.Error("WithMaxTokens(0) should still be rejected")
+	}
+}
+
 func TestGenerate_TemperatureExactMax(t *testing.T) {
-	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
 	c := mustNew(t, "key", WithDoer(mock))
 	_, err := c.Generate(context.Background(), "test", WithTemperature(2.0))
 	if err != nil {
@@ -663,7 +1010,7 @@ func TestGenerate_TemperatureExactMax(t *testing.T) {
 // --- Default config values ---
 
 func TestGenerate_DefaultConfig(t *testing.T) {
-	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
 	c := mustNew(t, "key", WithDoer(mock))
 
 	_, _ = c.Generate(context.Background(), "test")
@@ -713,6 +1060,11 @@ func TestNew_InvalidModelNames_Extended(t *testing.T) {
 		{"tab", "gemini\tmodel"},
 		{"colon", "model:evil"},
 		{"at sign", "model@v2"},
+		{"parent segment", "../tunedModels/x"},
+		{"inner parent segment", "models/../tunedModels/x"},
+		{"dot segment", "models/./gemini"},
+		{"empty segment", "models//gemini"},
+		{"trailing slash", "gemini/"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -724,9 +1076,2278 @@ func TestNew_InvalidModelNames_Extended(t *testing.T) {
 	}
 }
 
+func TestNew_ValidModelPaths(t *testing.T) {
+	for _, model := range []string{"models/gemini-2.0-flash", "tunedModels/my-model_1", "gemini-1.5-pro-002"} {
+		if _, err := New("key", WithModel(model)); err != nil {
+			t.Errorf("model %q should be valid, got: %v", model, err)
+		}
+	}
+}
+
 func TestNew_ValidModelDigitsOnly(t *testing.T) {
 	_, err := New("key", WithModel("1234"))
 	if err != nil {
 		t.Fatalf("digit-only model should be valid, got: %v", err)
 	}
 }
+
+// --- Function calling ---
+
+func TestGenerate_FunctionDeclarations(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	_, _ = c.Generate(context.Background(), "weather?",
+		WithFunctionDeclarations(FunctionDeclaration{
+			Name:        "get_weather",
+			Description: "Look up the weather",
+			Parameters: &Schema{
+				Type:       "OBJECT",
+				Properties: map[string]*Schema{"city": {Type: "STRING"}},
+				Required:   []string{"city"},
+			},
+		}),
+	)
+
+	var req Request
+	if err := json.Unmarshal(mock.body, &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(req.Tools) != 1 || len(req.Tools[0].FunctionDeclarations) != 1 {
+		t.Fatalf("expected one function declaration tool, got %+v", req.Tools)
+	}
+	fd := req.Tools[0].FunctionDeclarations[0]
+	if fd.Name != "get_weather" || fd.Parameters == nil || fd.Parameters.Properties["city"] == nil {
+		t.Errorf("unexpected declaration: %+v", fd)
+	}
+	if req.ToolConfig != nil {
+		t.Errorf("toolConfig should be omitted when unset, got %+v", req.ToolConfig)
+	}
+}
+
+func TestGenerate_ToolConfigModes(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  FunctionCallingConfig
+		want string
+	}{
+		{"auto", FunctionCallingConfig{Mode: FunctionCallingAuto}, `"toolConfig":{"functionCallingConfig":{"mode":"AUTO"}}`},
+		{"any", FunctionCallingConfig{Mode: FunctionCallingAny}, `"toolConfig":{"functionCallingConfig":{"mode":"ANY"}}`},
+		{"any with allowed", FunctionCallingConfig{Mode: FunctionCallingAny, AllowedFunctionNames: []string{"get_weather"}},
+			`"toolConfig":{"functionCallingConfig":{"mode":"ANY","allowedFunctionNames":["get_weather"]}}`},
+		{"none", FunctionCallingConfig{Mode: FunctionCallingNone}, `"toolConfig":{"functionCallingConfig":{"mode":"NONE"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockDoer{statusCode: 200, respBody: okBody}
+			c := mustNew(t, "key", WithDoer(mock))
+
+			_, err := c.Generate(context.Background(), "test",
+				WithFunctionDeclarations(FunctionDeclaration{Name: "get_weather"}),
+				WithToolConfig(ToolConfig{FunctionCallingConfig: &tt.cfg}),
+			)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(string(mock.body), tt.want) {
+				t.Errorf("request body missing %s, got %s", tt.want, mock.body)
+			}
+		})
+	}
+}
+
+func TestGenerate_ToolConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     FunctionCallingConfig
+		wantErr string
+	}{
+		{"unknown mode", FunctionCallingConfig{Mode: "SOMETIMES"}, "invalid function calling mode"},
+		{"allowed names without ANY", FunctionCallingConfig{Mode: FunctionCallingAuto, AllowedFunctionNames: []string{"f"}}, "require function calling mode ANY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockDoer{statusCode: 200, respBody: okBody}
+			c := mustNew(t, "key", WithDoer(mock))
+
+			_, err := c.Generate(context.Background(), "test", WithToolConfig(ToolConfig{FunctionCallingConfig: &tt.cfg}))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if mock.req != nil {
+				t.Error("request should not be sent when validation fails")
+			}
+		})
+	}
+}
+
+// seqDoer returns canned responses in order and records each request body.
+type seqDoer struct {
+	bodies    [][]byte
+	responses []string
+}
+
+func (s *seqDoer) Do(req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+	s.bodies = append(s.bodies, body)
+	resp := s.responses[len(s.bodies)-1]
+	return &http.Response{
+		StatusCode: 200,
+		Body:       io.NopCloser(strings.NewReader(resp)),
+	}, nil
+}
+
+func TestGenerateContents_FunctionCallRoundTrip(t *testing.T) {
+	doer := &seqDoer{responses: []string{
+		`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"It is 18C in Paris."}]},"finishReason":"STOP"}]}`,
+	}}
+	c := mustNew(t, "key", WithDoer(doer))
+	decl := WithFunctionDeclarations(FunctionDeclaration{Name: "get_weather"})
+	ctx := context.Background()
+
+	// Turn 1: the model asks for a function call.
+	first, err := c.Generate(ctx, "Weather in Paris?", decl)
+	if err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	calls := first.FunctionCalls()
+	if len(calls) != 1 || calls[0].Name != "get_weather" || calls[0].Args["city"] != "Paris" {
+		t.Fatalf("unexpected function calls: %+v", calls)
+	}
+
+	// Turn 2: send the result back and get the final answer.
+	contents := []Content{
+		{Role: RoleUser, Parts: []Part{{Text: "Weather in Paris?"}}},
+		{Role: RoleModel, Parts: []Part{{FunctionCall: &calls[0]}}},
+		{Role: RoleFunction, Parts: []Part{NewFunctionResponsePart("get_weather", map[string]any{"tempC": 18})}},
+	}
+	final, err := c.GenerateContents(ctx, contents, decl)
+	if err != nil {
+		t.Fatalf("second call: %v", err)
+	}
+	if got := final.Text(); got != "It is 18C in Paris." {
+		t.Errorf("Text(): got %q", got)
+	}
+
+	body := string(doer.bodies[1])
+	for _, want := range []string{
+		`"role":"function"`,
+		`"functionResponse":{"name":"get_weather","response":{"tempC":18}}`,
+		`"functionCall":{"name":"get_weather","args":{"city":"Paris"}}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("second request missing %s, got %s", want, body)
+		}
+	}
+}
+
+func TestGenerateContents_ToolRole(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	_, err := c.GenerateContents(context.Background(), []Content{
+		{Role: RoleTool, Parts: []Part{NewFunctionResponsePart("lookup", map[string]any{"ok": true})}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(mock.body), `"role":"tool"`) {
+		t.Errorf("expected tool role in body, got %s", mock.body)
+	}
+}
+
+func TestGenerateContents_MixedParts(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	contents := []Content{{Role: RoleUser, Parts: []Part{
+		{Text: "Compare these:"},
+		NewInlineDataPart("image/png", []byte("png")),
+		{FileData: &FileData{MimeType: "application/pdf", FileURI: "https://files.test/doc"}},
+		{Text: "Be brief."},
+	}}}
+	_, err := c.GenerateContents(context.Background(), contents, WithParts(Part{FileData: &FileData{FileURI: "https://files.test/clip"}}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var req struct {
+		Contents json.RawMessage `json:"contents"`
+	}
+	if err := json.Unmarshal(mock.body, &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := `[{"role":"user","parts":[` +
+		`{"text":"Compare these:"},` +
+		`{"inlineData":{"mimeType":"image/png","data":"cG5n"}},` +
+		`{"fileData":{"mimeType":"application/pdf","fileUri":"https://files.test/doc"}},` +
+		`{"text":"Be brief."},` +
+		`{"fileData":{"fileUri":"https://files.test/clip"}}]}]`
+	if string(req.Contents) != want {
+		t.Errorf("contents:\ngot  %s\nwant %s", req.Contents, want)
+	}
+	if len(contents[0].Parts) != 4 {
+		t.Errorf("caller's contents were modified: %d parts", len(contents[0].Parts))
+	}
+}
+
+func TestGenerateContents_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents []Content
+		wantErr  string
+	}{
+		{"empty", nil, "contents must not be empty"},
+		{"bad role", []Content{{Role: "system", Parts: []Part{{Text: "x"}}}}, "invalid role"},
+		{"no parts", []Content{{Role: RoleUser}}, "parts must not be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockDoer{statusCode: 200, respBody: okBody}
+			c := mustNew(t, "key", WithDoer(mock))
+			_, err := c.GenerateContents(context.Background(), tt.contents)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// --- Safety settings ---
+
+func TestGenerate_ClientSafetySettings(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock), WithDefaultSafetySettings(
+		SafetySetting{Category: HarmCategoryHarassment, Threshold: HarmBlockOnlyHigh},
+		SafetySetting{Category: HarmCategoryHateSpeech, Threshold: HarmBlockLowAndAbove},
+	))
+
+	_, _ = c.Generate(context.Background(), "test")
+
+	var req Request
+	if err := json.Unmarshal(mock.body, &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := []SafetySetting{
+		{Category: HarmCategoryHarassment, Threshold: HarmBlockOnlyHigh},
+		{Category: HarmCategoryHateSpeech, Threshold: HarmBlockLowAndAbove},
+	}
+	if len(req.SafetySettings) != len(want) {
+		t.Fatalf("safetySettings: got %+v, want %+v", req.SafetySettings, want)
+	}
+	for i := range want {
+		if req.SafetySettings[i] != want[i] {
+			t.Errorf("safetySettings[%d]: got %+v, want %+v", i, req.SafetySettings[i], want[i])
+		}
+	}
+}
+
+func TestGenerate_SafetySettingsPerCallOverride(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock), WithDefaultSafetySettings(
+		SafetySetting{Category: HarmCategoryHarassment, Threshold: HarmBlockOnlyHigh},
+		SafetySetting{Category: HarmCategoryHateSpeech, Threshold: HarmBlockLowAndAbove},
+	))
+
+	_, _ = c.Generate(context.Background(), "test", WithSafetySettings(
+		SafetySetting{Category: HarmCategoryHateSpeech, Threshold: HarmBlockNone},
+		SafetySetting{Category: HarmCategoryDangerousContent, Threshold: HarmBlockMediumAndAbove},
+	))
+
+	var req Request
+	if err := json.Unmarshal(mock.body, &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := []SafetySetting{
+		{Category: HarmCategoryHarassment, Threshold: HarmBlockOnlyHigh},
+		{Category: HarmCategoryHateSpeech, Threshold: HarmBlockNone},
+		{Category: HarmCategoryDangerousContent, Threshold: HarmBlockMediumAndAbove},
+	}
+	if len(req.SafetySettings) != len(want) {
+		t.Fatalf("safetySettings: got %+v, want %+v", req.SafetySettings, want)
+	}
+	for i := range want {
+		if req.SafetySettings[i] != want[i] {
+			t.Errorf("safetySettings[%d]: got %+v, want %+v", i, req.SafetySettings[i], want[i])
+		}
+	}
+
+	// Client defaults must not be mutated by the per-call merge.
+	if c.safety[1].Threshold != HarmBlockLowAndAbove {
+		t.Errorf("client default mutated: %+v", c.safety)
+	}
+}
+
+func TestGenerate_NoSafetySettingsOmitted(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	_, _ = c.Generate(context.Background(), "test")
+
+	if strings.Contains(string(mock.body), "safetySettings") {
+		t.Errorf("safetySettings should be omitted, got %s", mock.body)
+	}
+}
+
+func TestGenerate_SafetyThreshold(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock),
+		WithDefaultSafetySettings(SafetySetting{Category: HarmCategoryHarassment, Threshold: HarmBlockLowAndAbove}))
+
+	// The per-call category override wins even though it comes first.
+	_, err := c.Generate(context.Background(), "test",
+		WithSafetySettings(SafetySetting{Category: HarmCategoryHateSpeech, Threshold: HarmBlockNone}),
+		WithSafetyThreshold(HarmBlockOnlyHigh))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var req Request
+	if err := json.Unmarshal(mock.body, &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	got := make(map[string]string, len(req.SafetySettings))
+	for _, s := range req.SafetySettings {
+		got[s.Category] = s.Threshold
+	}
+	if len(req.SafetySettings) != len(harmCategories) {
+		t.Errorf("settings: got %d, want one per category: %+v", len(req.SafetySettings), req.SafetySettings)
+	}
+	for _, cat := range harmCategories {
+		want := HarmBlockOnlyHigh
+		if cat == HarmCategoryHateSpeech {
+			want = HarmBlockNone
+		}
+		if got[cat] != want {
+			t.Errorf("%s: got %q, want %q", cat, got[cat], want)
+		}
+	}
+}
+
+func TestGenerate_SafetyThresholdInvalid(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	if _, err := c.Generate(context.Background(), "test", WithSafetyThreshold("BLOCK_SOME")); err == nil {
+		t.Fatal("expected error for unknown threshold")
+	}
+	if mock.req != nil {
+		t.Error("no request should be sent")
+	}
+}
+
+// --- Response modalities ---
+
+func TestGenerate_ResponseModalities(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	_, err := c.Generate(context.Background(), "draw a cat", WithResponseModalities(ModalityText, ModalityImage))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(mock.body), `"responseModalities":["TEXT","IMAGE"]`) {
+		t.Errorf("expected responseModalities in body, got %s", mock.body)
+	}
+}
+
+func TestGenerate_ResponseModalitiesInvalid(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	_, err := c.Generate(context.Background(), "test", WithResponseModalities("VIDEO"))
+	if err == nil || !strings.Contains(err.Error(), "invalid response modality") {
+		t.Fatalf("expected modality error, got %v", err)
+	}
+}
+
+func TestGenerate_InlineImageResponse(t *testing.T) {
+	png := []byte{0x89, 'P', 'N', 'G', 0x0d, 0x0a, 0x1a, 0x0a}
+	respJSON := `{"candidates":[{"content":{"role":"model","parts":[
+		{"text":"Here is your cat."},
+		{"inlineData":{"mimeType":"image/png","data":"` + base64.StdEncoding.EncodeToString(png) + `"}}
+	]}}]}`
+	mock := &mockDoer{statusCode: 200, respBody: respJSON}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	resp, err := c.Generate(context.Background(), "draw a cat", WithResponseModalities(ModalityText, ModalityImage))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := resp.Text(); got != "Here is your cat." {
+		t.Errorf("Text(): got %q", got)
+	}
+	images := resp.Images()
+	if len(images) != 1 || images[0].MimeType != "image/png" {
+		t.Fatalf("Images(): got %+v", images)
+	}
+	data, err := images[0].Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !bytes.Equal(data, png) {
+		t.Errorf("decoded bytes: got %v, want %v", data, png)
+	}
+
+	// Re-marshaling must round-trip the inline part.
+	out, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var again Response
+	if err := json.Unmarshal(out, &again); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if imgs := again.Images(); len(imgs) != 1 || imgs[0].Data != images[0].Data {
+		t.Errorf("round-trip Images(): got %+v", imgs)
+	}
+}
+
+// --- Concurrency ---
+
+// echoDoer replies with the request's prompt as the candidate text. It is safe
+// for concurrent use and records every body it receives.
+type echoDoer struct {
+	mu     sync.Mutex
+	bodies map[string][]byte
+}
+
+func (e *echoDoer) Do(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	var r Request
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, err
+	}
+	prompt := r.Contents[0].Parts[0].Text
+
+	e.mu.Lock()
+	e.bodies[prompt] = body
+	e.mu.Unlock()
+
+	resp, _ := json.Marshal(Response{Candidates: []Candidate{{
+		Content: ResponseContent{Role: RoleModel, Parts: []ResponsePart{{Text: prompt}}},
+	}}})
+	return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewReader(resp))}, nil
+}
+
+func TestGenerate_ConcurrentCallsNoCrossTalk(t *testing.T) {
+	const n = 50
+	doer := &echoDoer{bodies: make(map[string][]byte)}
+	c := mustNew(t, "key", WithDoer(doer), WithDefaultSafetySettings(
+		SafetySetting{Category: HarmCategoryHarassment, Threshold: HarmBlockOnlyHigh},
+	))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			prompt := fmt.Sprintf("prompt-%d", i)
+			resp, err := c.Generate(context.Background(), prompt,
+				WithTemperature(float64(i%20)/10),
+				WithSafetySettings(SafetySetting{Category: HarmCategoryHateSpeech, Threshold: HarmBlockNone}),
+			)
+			if err != nil {
+				errs <- fmt.Errorf("%s: %v", prompt, err)
+				return
+			}
+			if got := resp.Text(); got != prompt {
+				errs <- fmt.Errorf("%s: response text %q", prompt, got)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if len(doer.bodies) != n {
+		t.Fatalf("expected %d distinct request bodies, got %d", n, len(doer.bodies))
+	}
+	for i := 0; i < n; i++ {
+		prompt := fmt.Sprintf("prompt-%d", i)
+		var req Request
+		if err := json.Unmarshal(doer.bodies[prompt], &req); err != nil {
+			t.Fatalf("%s: unmarshal: %v", prompt, err)
+		}
+		if req.Contents[0].Parts[0].Text != prompt {
+			t.Errorf("%s: body carries prompt %q", prompt, req.Contents[0].Parts[0].Text)
+		}
+		if want := float64(i%20) / 10; req.GenerationConfig.Temperature == nil || *req.GenerationConfig.Temperature != want {
+			t.Errorf("%s: temperature %v, want %v", prompt, req.GenerationConfig.Temperature, want)
+		}
+		if len(req.SafetySettings) != 2 {
+			t.Errorf("%s: safety settings %+v", prompt, req.SafetySettings)
+		}
+	}
+	if len(c.safety) != 1 {
+		t.Errorf("client safety defaults mutated: %+v", c.safety)
+	}
+}
+
+// --- System instructions ---
+
+func systemTexts(t *testing.T, body []byte) []string {
+	t.Helper()
+	var req Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if req.SystemInstruction == nil {
+		return nil
+	}
+	var texts []string
+	for _, p := range req.SystemInstruction.Parts {
+		texts = append(texts, p.Text)
+	}
+	return texts
+}
+
+func TestGenerate_SystemInstructionMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		perCall string
+		want    []string
+	}{
+		{"client only", nil, "", []string{"be terse"}},
+		{"default append", nil, "answer in French", []string{"be terse", "answer in French"}},
+		{"append", []Option{WithSystemInstructionMerge(SystemInstructionAppend)}, "answer in French", []string{"be terse", "answer in French"}},
+		{"prefix", []Option{WithSystemInstructionMerge(SystemInstructionPrefix)}, "answer in French", []string{"answer in French", "be terse"}},
+		{"replace", []Option{WithSystemInstructionMerge(SystemInstructionReplace)}, "answer in French", []string{"answer in French"}},
+		{"replace without per-call keeps client", []Option{WithSystemInstructionMerge(SystemInstructionReplace)}, "", []string{"be terse"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockDoer{statusCode: 200, respBody: okBody}
+			opts := append([]Option{WithDoer(mock), WithDefaultSystemInstruction("be terse")}, tt.opts...)
+			c := mustNew(t, "key", opts...)
+
+			var genOpts []GenerateOption
+			if tt.perCall != "" {
+				genOpts = append(genOpts, WithSystemInstruction(tt.perCall))
+			}
+			_, _ = c.Generate(context.Background(), "test", genOpts...)
+
+			got := systemTexts(t, mock.body)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("system instruction parts: got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerate_SystemInstructionPerCallOnly(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	_, _ = c.Generate(context.Background(), "test", WithSystemInstruction("be kind"))
+
+	if got := systemTexts(t, mock.body); len(got) != 1 || got[0] != "be kind" {
+		t.Errorf("system instruction parts: got %q", got)
+	}
+}
+
+func TestGenerate_NoSystemInstructionOmitted(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	_, _ = c.Generate(context.Background(), "test")
+
+	if strings.Contains(string(mock.body), "systemInstruction") {
+		t.Errorf("systemInstruction should be omitted, got %s", mock.body)
+	}
+}
+
+func TestNew_InvalidSystemInstructionMerge(t *testing.T) {
+	_, err := New("key", WithSystemInstructionMerge("interleave"))
+	if err == nil || !strings.Contains(err.Error(), "invalid system instruction merge mode") {
+		t.Fatalf("expected merge mode error, got %v", err)
+	}
+}
+
+// --- Model metadata validation ---
+
+func TestClient_MaxTemperature(t *testing.T) {
+	c := mustNew(t, "key")
+	if _, ok := c.MaxTemperature(); ok {
+		t.Error("MaxTemperature should be unknown without model info")
+	}
+
+	c = mustNew(t, "key", WithModelInfo(Model{MaxTemperature: 1.0}))
+	if got, ok := c.MaxTemperature(); !ok || got != 1.0 {
+		t.Errorf("MaxTemperature: got (%v, %v), want (1, true)", got, ok)
+	}
+}
+
+func TestGenerate_ValidateOptionsRejectsTemperatureAboveModelMax(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock), WithModelInfo(Model{MaxTemperature: 1.0}))
+
+	_, err := c.Generate(context.Background(), "test", WithTemperature(1.5), WithValidateOptions())
+	if err == nil || !strings.Contains(err.Error(), "exceeds model maximum") {
+		t.Fatalf("expected model maximum error, got %v", err)
+	}
+	if mock.req != nil {
+		t.Error("request should not be sent when pre-flight validation fails")
+	}
+}
+
+func TestGenerate_ValidateOptionsAllowsWithinMax(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock), WithModelInfo(Model{MaxTemperature: 1.0}))
+
+	if _, err := c.Generate(context.Background(), "test", WithTemperature(1.0), WithValidateOptions()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestGenerate_ModelMaxTemperatureIgnoredWithoutOptIn(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock), WithModelInfo(Model{MaxTemperature: 1.0}))
+
+	if _, err := c.Generate(context.Background(), "test", WithTemperature(1.5)); err != nil {
+		t.Fatalf("model max should only be enforced with WithValidateOptions, got: %v", err)
+	}
+}
+
+func TestGenerate_ValidateOptionsWithoutMetadata(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	if _, err := c.Generate(context.Background(), "test", WithTemperature(1.9), WithValidateOptions()); err != nil {
+		t.Fatalf("unknown model max should skip the check, got: %v", err)
+	}
+}
+
+// --- Metadata only ---
+
+func TestGenerate_WithMetadataOnly(t *testing.T) {
+	long := "a" + strings.Repeat("é", 300) // the 256-byte cut falls inside an "é"
+	body := fmt.Sprintf(`{"candidates":[{"content":{"role":"model","parts":[{"text":%q},{"text":"tail"}]},"finishReason":"MAX_TOKENS"}],
+		"usageMetadata":{"promptTokenCount":5,"candidatesTokenCount":300,"totalTokenCount":305}}`, long)
+	mock := &mockDoer{statusCode: 200, respBody: body}
+	c := mustNew(t, "key", WithDoer(mock), WithCache(4, 0))
+
+	resp, err := c.Generate(context.Background(), "test", WithMetadataOnly())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.UsageMetadata.TotalTokenCount != 305 || resp.Candidates[0].FinishReason != FinishReasonMaxTokens {
+		t.Errorf("metadata should be kept, got %+v / %q", resp.UsageMetadata, resp.Candidates[0].FinishReason)
+	}
+	text := resp.Text()
+	if len(text) != 255 || !utf8.ValidString(text) || !strings.HasPrefix(long, text) {
+		t.Errorf("text: got %d bytes (valid UTF-8: %v), want the first 255", len(text), utf8.ValidString(text))
+	}
+	if n := len(resp.Candidates[0].Content.Parts); n != 1 {
+		t.Errorf("parts past the limit should be dropped, got %d", n)
+	}
+
+	// The cache holds the full response for calls without the option.
+	full, err := c.Generate(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if full.Text() != long+"tail" {
+		t.Errorf("cached response should be complete, got %d bytes", len(full.Text()))
+	}
+}
+
+func TestTruncateCandidateText_ShortTextUnchanged(t *testing.T) {
+	resp := &Response{Candidates: []Candidate{{Content: ResponseContent{Parts: []ResponsePart{
+		{Text: "short"},
+		{FunctionCall: &FunctionCall{Name: "f"}},
+	}}}}}
+	truncateCandidateText(resp, 256)
+	if resp.Text() != "short" || len(resp.Candidates[0].Content.Parts) != 2 {
+		t.Errorf("got %+v", resp.Candidates[0].Content.Parts)
+	}
+}
+
+// --- Empty responses ---
+
+func TestGenerate_NoCandidates(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: `{"candidates":[],"usageMetadata":{"promptTokenCount":7,"totalTokenCount":7}}`}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	resp, err := c.Generate(context.Background(), "test")
+	if !errors.Is(err, ErrNoCandidates) {
+		t.Fatalf("expected ErrNoCandidates, got %v", err)
+	}
+	if resp != nil {
+		t.Errorf("expected nil response, got %+v", resp)
+	}
+	var re *ResponseError
+	if !errors.As(err, &re) {
+		t.Fatalf("expected *ResponseError, got %T", err)
+	}
+	if re.Response.UsageMetadata.PromptTokenCount != 7 {
+		t.Errorf("UsageMetadata should be inspectable, got %+v", re.Response.UsageMetadata)
+	}
+}
+
+func TestGenerate_EmptyObjectIsNoCandidates(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: `{}`}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	if _, err := c.Generate(context.Background(), "test"); !errors.Is(err, ErrNoCandidates) {
+		t.Fatalf("expected ErrNoCandidates, got %v", err)
+	}
+}
+
+// sequenceDoer replies 200 with each body in turn; the last one repeats.
+func sequenceDoer(calls *int, bodies ...string) Doer {
+	return DoerFunc(func(*http.Request) (*http.Response, error) {
+		body := bodies[min(*calls, len(bodies)-1)]
+		*calls++
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(body))}, nil
+	})
+}
+
+func TestGenerate_RetryOnEmpty(t *testing.T) {
+	var calls int
+	c := mustNew(t, "key", WithDoer(sequenceDoer(&calls, `{"candidates":[]}`, okBody)))
+
+	resp, err := c.Generate(context.Background(), "test", WithRetryOnEmpty(2))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Text() != "ok" || calls != 2 {
+		t.Errorf("got text %q after %d calls, want ok after 2", resp.Text(), calls)
+	}
+}
+
+func TestGenerate_RetryOnEmptyExhausted(t *testing.T) {
+	var calls int
+	c := mustNew(t, "key", WithDoer(sequenceDoer(&calls, `{}`)))
+
+	if _, err := c.Generate(context.Background(), "test", WithRetryOnEmpty(2)); !errors.Is(err, ErrNoCandidates) {
+		t.Fatalf("expected ErrNoCandidates, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("calls: got %d, want 3", calls)
+	}
+	if _, err := c.Generate(context.Background(), "test", WithRetryOnEmpty(-1)); err == nil {
+		t.Error("expected error for negative attempts")
+	}
+}
+
+func TestGenerate_RetryOnEmptyStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls int
+	c := mustNew(t, "key", WithDoer(DoerFunc(func(*http.Request) (*http.Response, error) {
+		calls++
+		cancel()
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+	})))
+
+	if _, err := c.Generate(ctx, "test", WithRetryOnEmpty(5)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls: got %d, want 1", calls)
+	}
+}
+
+func TestGenerate_ResponseValidator(t *testing.T) {
+	errNoCitation := errors.New("missing citation")
+	validate := func(resp *Response) error {
+		if !strings.Contains(resp.Text(), "[1]") {
+			return errNoCitation
+		}
+		return nil
+	}
+	cited := `{"candidates":[{"content":{"parts":[{"text":"fact [1]"}]}}]}`
+
+	var calls int
+	c := mustNew(t, "key", WithDoer(sequenceDoer(&calls, okBody, cited)))
+	resp, err := c.Generate(context.Background(), "test", WithResponseValidator(validate), WithRetryOnEmpty(1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Text() != "fact [1]" || calls != 2 {
+		t.Errorf("got text %q after %d calls, want cited text after 2", resp.Text(), calls)
+	}
+
+	calls = 0
+	c = mustNew(t, "key", WithDoer(sequenceDoer(&calls, okBody)))
+	_, err = c.Generate(context.Background(), "test", WithResponseValidator(validate))
+	var re *ResponseError
+	if !errors.Is(err, errNoCitation) || !errors.As(err, &re) || re.Response.Text() != "ok" {
+		t.Fatalf("expected *ResponseError wrapping the validator error, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls: got %d, want 1", calls)
+	}
+}
+
+func TestGenerate_BlockedPromptNotNoCandidates(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: `{"promptFeedback":{"blockReason":"SAFETY"}}`}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	resp, err := c.Generate(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("blocked prompts keep returning the response, got %v", err)
+	}
+	if resp.PromptFeedback == nil || resp.PromptFeedback.BlockReason != "SAFETY" {
+		t.Errorf("PromptFeedback: got %+v", resp.PromptFeedback)
+	}
+}
+
+func TestGenerate_StrictPromptFeedback(t *testing.T) {
+	body := `{"promptFeedback":{"blockReason":"SAFETY"},"candidates":[{"content":{"parts":[{"text":"partial"}]}}]}`
+	c := mustNew(t, "key", WithDoer(&mockDoer{statusCode: 200, respBody: body}))
+
+	resp, err := c.Generate(context.Background(), "test")
+	if err != nil || resp.Text() != "partial" {
+		t.Fatalf("lenient by default: got %v, %v", resp, err)
+	}
+
+	_, err = c.Generate(context.Background(), "test", WithStrictPromptFeedback())
+	var re *ResponseError
+	if !errors.Is(err, ErrBlocked) || !errors.As(err, &re) {
+		t.Fatalf("expected *ResponseError wrapping ErrBlocked, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "SAFETY") || re.Response.Text() != "partial" {
+		t.Errorf("error should name the reason and keep the response: %v", err)
+	}
+
+	c = mustNew(t, "key", WithDoer(&mockDoer{statusCode: 200, respBody: okBody}))
+	if _, err := c.Generate(context.Background(), "test", WithStrictPromptFeedback()); err != nil {
+		t.Errorf("unblocked response: unexpected error %v", err)
+	}
+}
+
+// --- WithHTTPClient ---
+
+func TestWithHTTPClient_UsesProvidedClient(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, okBody)
+	}))
+	defer srv.Close()
+
+	// Only the server's own client trusts its self-signed certificate, so a
+	// successful call proves the provided client was used.
+	c := mustNew(t, "key", WithHTTPClient(srv.Client()), WithBaseURL(srv.URL))
+	if c.doer != srv.Client() {
+		t.Fatal("doer should be the provided *http.Client")
+	}
+	resp, err := c.Generate(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Text() != "ok" {
+		t.Errorf("Text(): got %q", resp.Text())
+	}
+}
+
+func TestWithHTTPClient_TimeoutRespected(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	hc := srv.Client()
+	hc.Timeout = 50 * time.Millisecond
+	c := mustNew(t, "key", WithHTTPClient(hc), WithBaseURL(srv.URL))
+
+	start := time.Now()
+	_, err := c.Generate(context.Background(), "test")
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if !strings.Contains(err.Error(), "Client.Timeout") {
+		t.Errorf("expected client timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("timeout not respected, took %v", elapsed)
+	}
+}
+
+// --- WithProxy ---
+
+func TestWithProxy(t *testing.T) {
+	c := mustNew(t, "key", WithProxy("http://proxy.corp.example:3128"), WithTimeout(5*time.Second))
+
+	hc, ok := c.doer.(*http.Client)
+	if !ok {
+		t.Fatal("doer should be an *http.Client")
+	}
+	if hc.Timeout != 5*time.Second {
+		t.Errorf("timeout: got %v, want 5s", hc.Timeout)
+	}
+	tr, ok := hc.Transport.(*http.Transport)
+	if !ok || tr.Proxy == nil {
+		t.Fatal("expected an *http.Transport with a proxy function")
+	}
+	req, _ := http.NewRequest(http.MethodPost, defaultBaseURL, nil)
+	u, err := tr.Proxy(req)
+	if err != nil {
+		t.Fatalf("proxy func: %v", err)
+	}
+	if u == nil || u.String() != "http://proxy.corp.example:3128" {
+		t.Errorf("proxy URL: got %v", u)
+	}
+	if tr == http.DefaultTransport {
+		t.Error("proxy must not be set on the shared default transport")
+	}
+}
+
+func TestWithProxy_IgnoredWithCustomDoer(t *testing.T) {
+	mock := &mockDoer{}
+	c := mustNew(t, "key", WithProxy("http://proxy.corp.example:3128"), WithDoer(mock))
+	if c.doer != mock {
+		t.Error("doer should still be the custom mock")
+	}
+	if c.httpClient.Transport != nil {
+		t.Error("default client transport should be untouched when a Doer is supplied")
+	}
+}
+
+func TestWithTransportTimeouts(t *testing.T) {
+	c := mustNew(t, "key", WithTransportTimeouts(2*time.Second, 3*time.Second, 4*time.Second), WithProxy("http://proxy.corp.example:3128"))
+
+	hc, ok := c.doer.(*http.Client)
+	if !ok {
+		t.Fatal("doer should be an *http.Client")
+	}
+	tr, ok := hc.Transport.(*http.Transport)
+	if !ok || tr == http.DefaultTransport {
+		t.Fatal("expected a dedicated *http.Transport")
+	}
+	if tr.TLSHandshakeTimeout != 3*time.Second {
+		t.Errorf("TLSHandshakeTimeout: got %v, want 3s", tr.TLSHandshakeTimeout)
+	}
+	if tr.ResponseHeaderTimeout != 4*time.Second {
+		t.Errorf("ResponseHeaderTimeout: got %v, want 4s", tr.ResponseHeaderTimeout)
+	}
+	if tr.DialContext == nil || tr.Proxy == nil {
+		t.Error("dialer and proxy should both be configured on the same transport")
+	}
+	if def := http.DefaultTransport.(*http.Transport); def.ResponseHeaderTimeout != 0 {
+		t.Error("the shared default transport must not be modified")
+	}
+}
+
+func TestWithTransportTimeouts_ZeroKeepsDefaults(t *testing.T) {
+	c := mustNew(t, "key", WithTransportTimeouts(0, 0, time.Second))
+	tr := c.httpClient.Transport.(*http.Transport)
+	if want := http.DefaultTransport.(*http.Transport).TLSHandshakeTimeout; tr.TLSHandshakeTimeout != want {
+		t.Errorf("TLSHandshakeTimeout: got %v, want default %v", tr.TLSHandshakeTimeout, want)
+	}
+}
+
+func TestWithTransportTimeouts_IgnoredWithCustomDoer(t *testing.T) {
+	mock := &mockDoer{}
+	c := mustNew(t, "key", WithTransportTimeouts(time.Second, time.Second, time.Second), WithDoer(mock))
+	if c.doer != mock || c.httpClient.Transport != nil {
+		t.Error("custom Doer should be used and the default transport untouched")
+	}
+	if _, err := New("key", WithTransportTimeouts(-time.Second, 0, 0)); err == nil {
+		t.Error("expected error for negative timeout")
+	}
+}
+
+func TestWithProxy_InvalidURL(t *testing.T) {
+	for _, raw := range []string{"://bad", "proxy.corp.example:3128", "ftp://proxy.corp.example"} {
+		t.Run(raw, func(t *testing.T) {
+			_, err := New("key", WithProxy(raw))
+			if err == nil || !strings.Contains(err.Error(), "invalid proxy URL") {
+				t.Fatalf("expected invalid proxy error, got %v", err)
+			}
+		})
+	}
+}
+
+// --- Model output limit ---
+
+func TestGenerate_ModelOutputLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxTokens int
+		wantErr   bool
+	}{
+		{"under limit", 4096, false},
+		{"at limit", 8192, false},
+		{"over limit", 8193, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockDoer{statusCode: 200, respBody: okBody}
+			c := mustNew(t, "key", WithDoer(mock), WithModelOutputLimit(8192))
+
+			_, err := c.Generate(context.Background(), "test", WithMaxTokens(tt.maxTokens))
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "exceeds model output limit 8192") {
+					t.Fatalf("expected output limit error, got %v", err)
+				}
+				if mock.req != nil {
+					t.Error("request should not be sent when over the limit")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestGenerate_ModelOutputLimitCapsDefault(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock), WithModelInfo(Model{OutputTokenLimit: 8192}))
+
+	if _, err := c.Generate(context.Background(), "test"); err != nil {
+		t.Fatalf("default max tokens should be capped, got: %v", err)
+	}
+	var req Request
+	if err := json.Unmarshal(mock.body, &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if req.GenerationConfig.MaxOutputTokens != 8192 {
+		t.Errorf("maxOutputTokens: got %d, want 8192", req.GenerationConfig.MaxOutputTokens)
+	}
+}
+
+func TestGenerate_NoModelOutputLimit(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	if _, err := c.Generate(context.Background(), "test", WithMaxTokens(500_000)); err != nil {
+		t.Fatalf("no limit configured should skip the check, got: %v", err)
+	}
+}
+
+func TestWithModelOutputLimit_OverridesModelInfo(t *testing.T) {
+	c := mustNew(t, "key", WithModelOutputLimit(1024), WithModelInfo(Model{OutputTokenLimit: 8192}))
+	if c.modelInfo.OutputTokenLimit != 1024 {
+		t.Errorf("OutputTokenLimit: got %d, want 1024", c.modelInfo.OutputTokenLimit)
+	}
+	if _, err := New("key", WithModelOutputLimit(-1)); err == nil {
+		t.Error("expected error for negative output limit")
+	}
+}
+
+func TestGenerate_ClientDefaults(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock), WithDefaultMaxTokens(256), WithDefaultTemperature(0.2))
+
+	tests := []struct {
+		name     string
+		opts     []GenerateOption
+		wantMax  int
+		wantTemp float64
+	}{
+		{"client defaults", nil, 256, 0.2},
+		{"per-call override", []GenerateOption{WithMaxTokens(64), WithTemperature(0.9)}, 64, 0.9},
+		{"generation config override", []GenerateOption{WithGenerationConfig(GenerationConfig{MaxOutputTokens: 128})}, 128, 0.2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := c.Generate(context.Background(), "test", tt.opts...); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var req Request
+			if err := json.Unmarshal(mock.body, &req); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if req.GenerationConfig.MaxOutputTokens != tt.wantMax {
+				t.Errorf("maxOutputTokens: got %d, want %d", req.GenerationConfig.MaxOutputTokens, tt.wantMax)
+			}
+			if req.GenerationConfig.Temperature == nil || *req.GenerationConfig.Temperature != tt.wantTemp {
+				t.Errorf("temperature: got %v, want %v", req.GenerationConfig.Temperature, tt.wantTemp)
+			}
+		})
+	}
+}
+
+func TestNew_InvalidClientDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{"zero max tokens", WithDefaultMaxTokens(0)},
+		{"max tokens too large", WithDefaultMaxTokens(maxMaxTokens + 1)},
+		{"negative temperature", WithDefaultTemperature(-0.1)},
+		{"temperature too high", WithDefaultTemperature(maxTemperature + 0.1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New("key", tt.opt); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+	if _, err := New("key", WithDefaultMaxTokens(9000), WithModelOutputLimit(8192)); err == nil {
+		t.Error("expected error for default above model output limit")
+	}
+}
+
+// --- Model override ---
+
+func TestGenerate_ModelPrecedence(t *testing.T) {
+	ctxModel := ContextWithModel(context.Background(), "ctx-model")
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		opts    []GenerateOption
+		wantURL string
+	}{
+		{"client default", context.Background(), nil, "https://api.test/client-model:generateContent"},
+		{"context", ctxModel, nil, "https://api.test/ctx-model:generateContent"},
+		{"per-call over context", ctxModel, []GenerateOption{WithRequestModel("call-model")}, "https://api.test/call-model:generateContent"},
+		{"per-call", context.Background(), []GenerateOption{WithRequestModel("call-model")}, "https://api.test/call-model:generateContent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockDoer{statusCode: 200, respBody: okBody}
+			c := mustNew(t, "key", WithDoer(mock), WithModel("client-model"), WithBaseURL("https://api.test"))
+
+			if _, err := c.Generate(tt.ctx, "test", tt.opts...); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := mock.req.URL.String(); got != tt.wantURL {
+				t.Errorf("URL: got %q, want %q", got, tt.wantURL)
+			}
+			if c.model != "client-model" {
+				t.Error("the client's model must not change")
+			}
+		})
+	}
+}
+
+func TestModelFromContext(t *testing.T) {
+	if m, ok := ModelFromContext(context.Background()); ok || m != "" {
+		t.Errorf("empty context: got (%q, %v)", m, ok)
+	}
+	if m, ok := ModelFromContext(ContextWithModel(context.Background(), "m")); !ok || m != "m" {
+		t.Errorf("got (%q, %v), want (m, true)", m, ok)
+	}
+}
+
+func TestGenerate_ModelOverrideSkipsModelInfo(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock), WithModelOutputLimit(1024))
+
+	if _, err := c.Generate(context.Background(), "test", WithMaxTokens(4096)); err == nil {
+		t.Fatal("expected the client model's output limit to apply")
+	}
+	if _, err := c.Generate(context.Background(), "test", WithMaxTokens(4096), WithRequestModel("other-model")); err != nil {
+		t.Fatalf("output limit should not apply to another model, got %v", err)
+	}
+	if _, err := c.Generate(ContextWithModel(context.Background(), "bad model!"), "test"); err == nil {
+		t.Error("expected error for invalid context model")
+	}
+}
+
+func TestCountTokens_ContextModel(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: `{"totalTokens":3}`}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	if _, err := c.CountTokens(ContextWithModel(context.Background(), "ctx-model"), "test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(mock.req.URL.Path, "ctx-model:countTokens") || !strings.Contains(string(mock.body), `"model":"models/ctx-model"`) {
+		t.Errorf("countTokens should target the context model: %s %s", mock.req.URL, mock.body)
+	}
+}
+
+// --- Labels ---
+
+func TestGenerate_Labels(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	_, err := c.Generate(context.Background(), "test", WithLabels(map[string]string{
+		"team":    "search",
+		"project": "q4-launch",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var req Request
+	if err := json.Unmarshal(mock.body, &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if req.Labels["team"] != "search" || req.Labels["project"] != "q4-launch" {
+		t.Errorf("labels: got %v", req.Labels)
+	}
+}
+
+func TestGenerate_LabelsOmittedWhenUnset(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	_, _ = c.Generate(context.Background(), "test")
+
+	if strings.Contains(string(mock.body), "labels") {
+		t.Errorf("labels should be omitted, got %s", mock.body)
+	}
+}
+
+func TestGenerate_LabelsInvalid(t *testing.T) {
+	tooMany := make(map[string]string)
+	for i := 0; i <= maxLabels; i++ {
+		tooMany[fmt.Sprintf("k%d", i)] = "v"
+	}
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		wantErr string
+	}{
+		{"empty key", map[string]string{"": "v"}, "invalid label key"},
+		{"uppercase key", map[string]string{"Team": "v"}, "invalid label key"},
+		{"key starts with digit", map[string]string{"1team": "v"}, "invalid label key"},
+		{"key too long", map[string]string{strings.Repeat("k", 64): "v"}, "invalid label key"},
+		{"value too long", map[string]string{"team": strings.Repeat("v", 64)}, "invalid value for label"},
+		{"value with space", map[string]string{"team": "a b"}, "invalid value for label"},
+		{"too many", tooMany, "at most 64 labels"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockDoer{statusCode: 200, respBody: okBody}
+			c := mustNew(t, "key", WithDoer(mock))
+			_, err := c.Generate(context.Background(), "test", WithLabels(tt.labels))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestGenerate_LabelsAtLimits(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+	_, err := c.Generate(context.Background(), "test", WithLabels(map[string]string{
+		"k" + strings.Repeat("x", 62): strings.Repeat("v", 63),
+		"empty-value":                 "",
+	}))
+	if err != nil {
+		t.Fatalf("labels at the limits should be valid, got: %v", err)
+	}
+}
+
+// --- Audio input ---
+
+type recordingLogger struct {
+	mu    sync.Mutex
+	warns []string
+}
+
+func (l *recordingLogger) Warn(msg string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warns = append(l.warns, fmt.Sprint(append([]any{msg}, args...)...))
+}
+
+func TestGenerate_WithAudio(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	audio := []byte("RIFF\x00\x00WAVE")
+	_, err := c.Generate(context.Background(), "transcribe this", WithAudio("audio/wav", audio))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var req map[string]any
+	if err := json.Unmarshal(mock.body, &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	contents := req["contents"].([]any)
+	if len(contents) != 1 {
+		t.Fatalf("expected audio in the prompt turn, got %d contents", len(contents))
+	}
+	parts := contents[0].(map[string]any)["parts"].([]any)
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 parts, got %d", len(parts))
+	}
+	if parts[0].(map[string]any)["text"] != "transcribe this" {
+		t.Errorf("first part should be the prompt, got %v", parts[0])
+	}
+	inline := parts[1].(map[string]any)["inlineData"].(map[string]any)
+	if inline["mimeType"] != "audio/wav" {
+		t.Errorf("mimeType: got %v", inline["mimeType"])
+	}
+	if inline["data"] != base64.StdEncoding.EncodeToString(audio) {
+		t.Errorf("data: got %v", inline["data"])
+	}
+}
+
+func TestGenerate_WithAudioInvalidMIME(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	_, err := c.Generate(context.Background(), "test", WithAudio("image/png", []byte("x")))
+	if err == nil || !strings.Contains(err.Error(), "audio MIME type") {
+		t.Fatalf("expected MIME type error, got %v", err)
+	}
+	if mock.body != nil {
+		t.Error("request should not be sent")
+	}
+}
+
+func TestGenerateContents_WithAudioAppendsUserTurn(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	contents := []Content{
+		{Role: RoleUser, Parts: []Part{{Text: "hi"}}},
+		{Role: RoleModel, Parts: []Part{{Text: "hello"}}},
+	}
+	if _, err := c.GenerateContents(context.Background(), contents, WithAudio("audio/mp3", []byte("id3"))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var req Request
+	if err := json.Unmarshal(mock.body, &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(req.Contents) != 3 || req.Contents[2].Role != RoleUser || req.Contents[2].Parts[0].InlineData == nil {
+		t.Errorf("expected trailing user turn with audio, got %+v", req.Contents)
+	}
+	if len(contents) != 2 {
+		t.Error("caller's contents should not be modified")
+	}
+}
+
+func TestGenerate_WithAudioWarnsWhenLarge(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		wantWarn bool
+	}{
+		{"small", 1024, false},
+		{"near limit", inlineWarnBytes, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &recordingLogger{}
+			mock := &mockDoer{statusCode: 200, respBody: okBody}
+			c := mustNew(t, "key", WithDoer(mock), WithLogger(log))
+
+			// Raw size yielding an encoded size of at least tt.size.
+			raw := make([]byte, tt.size*3/4+3)
+			if _, err := c.Generate(context.Background(), "test", WithAudio("audio/wav", raw), WithRequestID("trace-9")); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := len(log.warns) > 0; got != tt.wantWarn {
+				t.Errorf("warned = %v, want %v (%v)", got, tt.wantWarn, log.warns)
+			}
+			if tt.wantWarn && !strings.Contains(log.warns[0], "trace-9") {
+				t.Errorf("warning should carry the request ID, got %q", log.warns[0])
+			}
+		})
+	}
+}
+
+func TestGenerate_WithPDF(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	pdf := []byte("%PDF-1.7 minimal")
+	if _, err := c.Generate(context.Background(), "summarize", WithPDF(pdf)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var req Request
+	if err := json.Unmarshal(mock.body, &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	parts := req.Contents[0].Parts
+	if len(parts) != 2 || parts[1].InlineData == nil {
+		t.Fatalf("expected prompt then PDF part, got %+v", parts)
+	}
+	if parts[1].InlineData.MimeType != "application/pdf" {
+		t.Errorf("mimeType: got %q", parts[1].InlineData.MimeType)
+	}
+	if parts[1].InlineData.Data != base64.StdEncoding.EncodeToString(pdf) {
+		t.Errorf("data: got %q", parts[1].InlineData.Data)
+	}
+
+	if _, err := c.Generate(context.Background(), "text only"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(mock.body), "inlineData") || strings.Contains(string(mock.body), "mimeType") {
+		t.Errorf("text-only request should omit inline data: %s", mock.body)
+	}
+}
+
+func TestGenerate_WithPDFTooLarge(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	for _, pdf := range [][]byte{nil, make([]byte, maxInlineBytes*3/4+1)} {
+		_, err := c.Generate(context.Background(), "summarize", WithPDF(pdf))
+		if err == nil {
+			t.Fatalf("expected error for %d-byte PDF", len(pdf))
+		}
+		if len(pdf) > 0 && !strings.Contains(err.Error(), "File API") {
+			t.Errorf("error should suggest the File API, got %v", err)
+		}
+	}
+	if mock.body != nil {
+		t.Error("request should not be sent")
+	}
+}
+
+// --- File API media ---
+
+func TestGenerate_WithVideoFileMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []VideoOption
+		wantMeta string
+	}{
+		{"no options", nil, ""},
+		{"offsets", []VideoOption{WithVideoStartOffset(1500 * time.Millisecond), WithVideoEndOffset(time.Minute)},
+			`{"startOffset":"1.5s","endOffset":"60s"}`},
+		{"fps", []VideoOption{WithVideoFPS(0.5)}, `{"fps":0.5}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockDoer{statusCode: 200, respBody: okBody}
+			c := mustNew(t, "key", WithDoer(mock))
+
+			uri := "https://generativelanguage.googleapis.com/v1beta/files/abc"
+			if _, err := c.Generate(context.Background(), "describe", WithVideoFile(uri, "video/mp4", tt.opts...)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var req struct {
+				Contents []struct {
+					Parts []map[string]json.RawMessage `json:"parts"`
+				} `json:"contents"`
+			}
+			if err := json.Unmarshal(mock.body, &req); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			part := req.Contents[0].Parts[1]
+			if want := `{"mimeType":"video/mp4","fileUri":"` + uri + `"}`; string(part["fileData"]) != want {
+				t.Errorf("fileData: got %s, want %s", part["fileData"], want)
+			}
+			if got := string(part["videoMetadata"]); got != tt.wantMeta {
+				t.Errorf("videoMetadata: got %q, want %q", got, tt.wantMeta)
+			}
+		})
+	}
+}
+
+func TestGenerate_FileOptionsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		opt     GenerateOption
+		wantErr string
+	}{
+		{"empty file URI", WithFile(" ", "application/pdf"), "file URI"},
+		{"video MIME", WithVideoFile("files/abc", "audio/mp3"), "video MIME type"},
+		{"empty video URI", WithVideoFile("", "video/mp4"), "file URI"},
+		{"fps too high", WithVideoFile("files/abc", "video/mp4", WithVideoFPS(30)), "FPS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockDoer{statusCode: 200, respBody: okBody}
+			c := mustNew(t, "key", WithDoer(mock))
+			_, err := c.Generate(context.Background(), "test", tt.opt)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// --- Request ID ---
+
+func TestGenerate_RequestIDRoundTrip(t *testing.T) {
+	mock := &mockDoer{
+		statusCode: 200,
+		respBody:   okBody,
+		header:     http.Header{"X-Goog-Request-Id": {"srv-42"}},
+	}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	resp, err := c.Generate(context.Background(), "test", WithRequestID("trace-1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := mock.req.Header.Get("x-request-id"); got != "trace-1" {
+		t.Errorf("x-request-id: got %q, want %q", got, "trace-1")
+	}
+	if resp.ResponseID != "srv-42" {
+		t.Errorf("ResponseID: got %q, want %q", resp.ResponseID, "srv-42")
+	}
+	if strings.Contains(string(mock.body), "srv-42") || strings.Contains(string(mock.body), "trace-1") {
+		t.Errorf("IDs should not appear in the request body: %s", mock.body)
+	}
+}
+
+func TestGenerate_RequestIDUnset(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	resp, err := c.Generate(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := mock.req.Header["X-Request-Id"]; ok {
+		t.Error("x-request-id should not be sent when unset")
+	}
+	if resp.ResponseID != "" {
+		t.Errorf("ResponseID: got %q, want empty", resp.ResponseID)
+	}
+}
+
+func TestGenerate_RequestIDInvalid(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	_, err := c.Generate(context.Background(), "test", WithRequestID("a\r\nX-Injected: 1"))
+	if err == nil || !strings.Contains(err.Error(), "line breaks") {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+}
+
+// --- BuildRequest ---
+
+func TestBuildRequest_MatchesSentBody(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock), WithDefaultSystemInstruction("be brief"))
+	opts := []GenerateOption{
+		WithMaxTokens(256),
+		WithTemperature(0.2),
+		WithGoogleSearch(),
+		WithLabels(map[string]string{"team": "search"}),
+	}
+
+	req, err := c.BuildRequest("hello", opts...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.Generate(context.Background(), "hello", opts...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	built, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if string(built) != string(mock.body) {
+		t.Errorf("BuildRequest body differs from sent body:\n built: %s\n  sent: %s", built, mock.body)
+	}
+}
+
+func TestBuildRequest_NoHTTPCall(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	req, err := c.BuildRequest("hello")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mock.req != nil {
+		t.Error("BuildRequest should not perform an HTTP call")
+	}
+	if req.Contents[0].Parts[0].Text != "hello" || req.GenerationConfig.MaxOutputTokens != 32000 {
+		t.Errorf("unexpected request: %+v", req)
+	}
+}
+
+func TestBuildRequest_Validates(t *testing.T) {
+	c := mustNew(t, "key", WithDoer(&mockDoer{}), WithModelOutputLimit(100))
+
+	if _, err := c.BuildRequest("hello", WithMaxTokens(200)); err == nil {
+		t.Error("expected output limit error")
+	}
+	if _, err := c.BuildRequest("hello", WithTemperature(3)); err == nil {
+		t.Error("expected temperature error")
+	}
+}
+
+// --- doRequest endpoints ---
+
+func TestEndpoint(t *testing.T) {
+	c := mustNew(t, "key", WithDoer(&mockDoer{}), WithBaseURL("https://api.test/v1beta/models"), WithModel("models/m-1"))
+
+	tests := []struct {
+		method string
+		query  url.Values
+		want   string
+	}{
+		{"generateContent", nil, "https://api.test/v1beta/models/m-1:generateContent"},
+		{"streamGenerateContent", url.Values{"alt": {"sse"}}, "https://api.test/v1beta/models/m-1:streamGenerateContent?alt=sse"},
+		{"countTokens", url.Values{}, "https://api.test/v1beta/models/m-1:countTokens"},
+	}
+	for _, tt := range tests {
+		if got := c.endpoint(tt.method, tt.query); got != tt.want {
+			t.Errorf("endpoint(%q, %v): got %q, want %q", tt.method, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestEndpoint_EscapesModel(t *testing.T) {
+	c := mustNew(t, "key", WithDoer(&mockDoer{}), WithBaseURL("https://api.test/v1beta/models"))
+	// New rejects such names; set one directly to exercise the escaping.
+	c.model = "models/tuned model?v=1#x"
+
+	want := "https://api.test/v1beta/models/tuned%20model%3Fv=1%23x:generateContent"
+	if got := c.endpoint("generateContent", nil); got != want {
+		t.Errorf("endpoint: got %q, want %q", got, want)
+	}
+}
+
+func TestNew_InvalidBaseURL(t *testing.T) {
+	for _, u := range []string{"https://", "https://exa mple.com"} {
+		if _, err := New("key", WithBaseURL(u)); err == nil {
+			t.Errorf("WithBaseURL(%q): expected error", u)
+		}
+	}
+}
+
+func TestDoRequest_MethodsAndRawBody(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: `{"totalTokens":5}`}
+	c := mustNew(t, "key", WithDoer(mock), WithBaseURL("https://api.test"), WithModel("m"))
+
+	var counted struct {
+		TotalTokens int `json:"totalTokens"`
+	}
+	if err := c.doRequest(context.Background(), "countTokens", nil, map[string]string{}, &counted, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := mock.req.URL.String(); got != "https://api.test/m:countTokens" {
+		t.Errorf("URL: got %q", got)
+	}
+	if counted.TotalTokens != 5 {
+		t.Errorf("JSON body not decoded: %+v", counted)
+	}
+
+	mock.respBody = "\x89PNG raw bytes"
+	var raw []byte
+	if err := c.doRequest(context.Background(), "generateContent", url.Values{"alt": {"media"}}, map[string]string{}, &raw, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := mock.req.URL.String(); got != "https://api.test/m:generateContent?alt=media" {
+		t.Errorf("URL: got %q", got)
+	}
+	if string(raw) != "\x89PNG raw bytes" {
+		t.Errorf("raw body: got %q", raw)
+	}
+}
+
+// --- Usage logging ---
+
+// usageRecorder captures Info calls as message plus key/value fields.
+type usageRecorder struct {
+	msgs   []string
+	fields []map[string]any
+}
+
+func (u *usageRecorder) Info(msg string, args ...any) {
+	f := make(map[string]any)
+	for i := 0; i+1 < len(args); i += 2 {
+		f[fmt.Sprint(args[i])] = args[i+1]
+	}
+	u.msgs = append(u.msgs, msg)
+	u.fields = append(u.fields, f)
+}
+
+func TestGenerate_UsageLogger(t *testing.T) {
+	body := `{"candidates":[{"content":{"parts":[{"text":"ok"}]}}],"usageMetadata":{"promptTokenCount":11,"candidatesTokenCount":7,"totalTokenCount":18}}`
+	mock := &mockDoer{statusCode: 200, respBody: body}
+	rec := &usageRecorder{}
+	c := mustNew(t, "key", WithDoer(mock), WithModel("gemini-2.5-flash"), WithUsageLogger(rec))
+
+	if _, err := c.Generate(context.Background(), "test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rec.fields) != 1 {
+		t.Fatalf("expected 1 usage log, got %d", len(rec.fields))
+	}
+	want := map[string]any{
+		"model":            "gemini-2.5-flash",
+		"prompt_tokens":    11,
+		"candidate_tokens": 7,
+		"total_tokens":     18,
+	}
+	for k, v := range want {
+		if rec.fields[0][k] != v {
+			t.Errorf("%s: got %v, want %v", k, rec.fields[0][k], v)
+		}
+	}
+}
+
+func TestGenerate_UsageLoggerSkipsFailures(t *testing.T) {
+	mock := &mockDoer{statusCode: 500, respBody: `{"error":"boom"}`}
+	rec := &usageRecorder{}
+	c := mustNew(t, "key", WithDoer(mock), WithUsageLogger(rec))
+
+	if _, err := c.Generate(context.Background(), "test"); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(rec.msgs) != 0 {
+		t.Errorf("failed calls should not log usage, got %v", rec.msgs)
+	}
+}
+
+// --- Candidate count ---
+
+func TestGenerate_CandidateCount(t *testing.T) {
+	body := `{"candidates":[{"content":{"parts":[{"text":"a"}]}},{"content":{"parts":[{"text":"b"}]}}]}`
+	mock := &mockDoer{statusCode: 200, respBody: body}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	resp, err := c.Generate(context.Background(), "test", WithCandidateCount(2))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(mock.body), `"candidateCount":2`) {
+		t.Errorf("candidateCount not sent: %s", mock.body)
+	}
+	if len(resp.Candidates) != 2 || resp.Candidates[1].Text() != "b" {
+		t.Errorf("candidates: got %+v", resp.Candidates)
+	}
+
+	_, _ = c.Generate(context.Background(), "test")
+	if strings.Contains(string(mock.body), "candidateCount") {
+		t.Errorf("candidateCount should be omitted by default: %s", mock.body)
+	}
+}
+
+func TestGenerate_CandidateCountInvalid(t *testing.T) {
+	c := mustNew(t, "key", WithDoer(&mockDoer{statusCode: 200, respBody: okBody}))
+	for _, n := range []int{-1, 9} {
+		if _, err := c.Generate(context.Background(), "test", WithCandidateCount(n)); err == nil {
+			t.Errorf("WithCandidateCount(%d): expected error", n)
+		}
+	}
+}
+
+func TestGenerate_Logprobs(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	if _, err := c.Generate(context.Background(), "test", WithLogprobs(3)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(mock.body), `"responseLogprobs":true,"logprobs":3`) {
+		t.Errorf("logprobs not sent: %s", mock.body)
+	}
+
+	if _, err := c.Generate(context.Background(), "test", WithLogprobs(0)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(mock.body), `"responseLogprobs":true`) || strings.Contains(string(mock.body), `"logprobs"`) {
+		t.Errorf("WithLogprobs(0) should request chosen tokens only: %s", mock.body)
+	}
+
+	_, _ = c.Generate(context.Background(), "test")
+	if strings.Contains(string(mock.body), "ogprobs") {
+		t.Errorf("logprobs should be omitted by default: %s", mock.body)
+	}
+
+	for _, n := range []int{-1, 21} {
+		if _, err := c.Generate(context.Background(), "test", WithLogprobs(n)); err == nil {
+			t.Errorf("WithLogprobs(%d): expected error", n)
+		}
+	}
+}
+
+func TestGenerate_AudioTimestamp(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	_, _ = c.Generate(context.Background(), "test")
+	if strings.Contains(string(mock.body), "audioTimestamp") {
+		t.Errorf("audioTimestamp should be omitted by default: %s", mock.body)
+	}
+
+	_, _ = c.Generate(context.Background(), "test", WithAudioTimestamp())
+	if !strings.Contains(string(mock.body), `"audioTimestamp":true`) {
+		t.Errorf("audioTimestamp not sent: %s", mock.body)
+	}
+
+	_, _ = c.Generate(context.Background(), "test", WithGenerationConfig(GenerationConfig{AudioTimestamp: true}))
+	if !strings.Contains(string(mock.body), `"audioTimestamp":true`) {
+		t.Errorf("audioTimestamp not taken from the baseline: %s", mock.body)
+	}
+}
+
+func TestGenerate_SamplingOptions(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	_, err := c.Generate(context.Background(), "test", WithTopP(0), WithTopK(40), WithSeed(0), WithStopSequences("END", "\n\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{`"topP":0`, `"topK":40`, `"seed":0`, `"stopSequences":["END","\n\n"]`} {
+		if !strings.Contains(string(mock.body), want) {
+			t.Errorf("missing %s in %s", want, mock.body)
+		}
+	}
+
+	_, _ = c.Generate(context.Background(), "test")
+	for _, key := range []string{"topP", "topK", "seed", "stopSequences"} {
+		if strings.Contains(string(mock.body), key) {
+			t.Errorf("%s should be omitted by default: %s", key, mock.body)
+		}
+	}
+
+	seed := 7
+	_, _ = c.Generate(context.Background(), "test", WithGenerationConfig(GenerationConfig{Seed: &seed, StopSequences: []string{"x"}}), WithSeed(8))
+	if !strings.Contains(string(mock.body), `"seed":8`) || !strings.Contains(string(mock.body), `"stopSequences":["x"]`) {
+		t.Errorf("per-call options should override the baseline: %s", mock.body)
+	}
+}
+
+func TestGenerate_SamplingOptionsInvalid(t *testing.T) {
+	c := mustNew(t, "key", WithDoer(&mockDoer{statusCode: 200, respBody: okBody}))
+	for name, opt := range map[string]GenerateOption{
+		"topP negative":  WithTopP(-0.1),
+		"topP above one": WithTopP(1.5),
+		"topK zero":      WithTopK(0),
+		"too many stops": WithStopSequences("a", "b", "c", "d", "e", "f"),
+		"empty stop":     WithStopSequences(""),
+	} {
+		if _, err := c.Generate(context.Background(), "test", opt); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestGenerateFromJSON(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	body := json.RawMessage(`{ "contents": [{"parts": [{"text": "hi"}]}],
+  "futureField": {"enabled": true} }`)
+	resp, err := c.GenerateFromJSON(context.Background(), body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(mock.body) != string(body) {
+		t.Errorf("body not sent as-is:\ngot  %s\nwant %s", mock.body, body)
+	}
+	if !strings.HasSuffix(mock.req.URL.Path, ":generateContent") || mock.req.Method != http.MethodPost {
+		t.Errorf("unexpected request: %s %s", mock.req.Method, mock.req.URL)
+	}
+	if resp.Text() != "ok" {
+		t.Errorf("text: got %q", resp.Text())
+	}
+
+	mock.req = nil
+	if _, err := c.GenerateFromJSON(context.Background(), json.RawMessage(`{"contents":`)); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+	if mock.req != nil {
+		t.Error("invalid JSON should not be sent")
+	}
+}
+
+// --- API errors ---
+
+func TestGenerate_APIErrorJSONEnvelope(t *testing.T) {
+	body := `{"error":{"code":400,"message":"API key not valid.","status":"INVALID_ARGUMENT","details":[{"@type":"type.googleapis.com/google.rpc.ErrorInfo","reason":"API_KEY_INVALID"}]}}`
+	mock := &mockDoer{statusCode: 400, respBody: body}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	_, err := c.Generate(context.Background(), "test")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected *APIError, got %T: %v", err, err)
+	}
+	if apiErr.StatusCode != 400 || apiErr.Status != "INVALID_ARGUMENT" || apiErr.Message != "API key not valid." {
+		t.Errorf("unexpected APIError: %+v", apiErr)
+	}
+	if len(apiErr.Details) != 1 || !strings.Contains(string(apiErr.Details[0]), "API_KEY_INVALID") {
+		t.Errorf("details: got %s", apiErr.Details)
+	}
+	if err.Error() != "gemini: HTTP 400: API key not valid." {
+		t.Errorf("message: got %q", err.Error())
+	}
+}
+
+func TestGenerate_APIErrorNonJSONBody(t *testing.T) {
+	body := "<html><body><h1>502 Bad Gateway</h1></body></html>"
+	mock := &mockDoer{statusCode: 502, respBody: body}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	_, err := c.Generate(context.Background(), "test")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected *APIError, got %T: %v", err, err)
+	}
+	if apiErr.StatusCode != 502 || apiErr.Status != "" || apiErr.Message != body {
+		t.Errorf("unexpected APIError: %+v", apiErr)
+	}
+	if !strings.Contains(err.Error(), "HTTP 502") {
+		t.Errorf("message: got %q", err.Error())
+	}
+}
+
+func TestGenerate_ModelNotFound(t *testing.T) {
+	const notFound = `{"error":{"code":404,"status":"NOT_FOUND","message":"models/gemini-9-ultra is not found for API version v1beta, or is not supported for generateContent."}}`
+	tests := map[string]struct {
+		body string
+		want bool
+	}{
+		"model 404":    {notFound, true},
+		"proxy 404":    {"<html>Not Found</html>", false},
+		"other entity": {`{"error":{"code":404,"status":"NOT_FOUND","message":"File files/abc does not exist."}}`, false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := mustNew(t, "key", WithModel("gemini-9-ultra"), WithDoer(&mockDoer{statusCode: 404, respBody: tt.body}))
+			_, err := c.Generate(context.Background(), "test")
+			if got := errors.Is(err, ErrModelNotFound); got != tt.want {
+				t.Fatalf("errors.Is(ErrModelNotFound): got %v, want %v (%v)", got, tt.want, err)
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != 404 {
+				t.Errorf("expected *APIError with status 404, got %v", err)
+			}
+			if tt.want && !strings.Contains(err.Error(), `"gemini-9-ultra"`) {
+				t.Errorf("error should name the model: %v", err)
+			}
+		})
+	}
+}
+
+// --- Generation config baseline ---
+
+func TestWithGenerationConfig_ExplicitOptionWins(t *testing.T) {
+	temp := 0.3
+	base := GenerationConfig{
+		MaxOutputTokens:  512,
+		Temperature:      &temp,
+		ResponseMimeType: "application/json",
+		CandidateCount:   2,
+	}
+	tests := []struct {
+		name string
+		opts []GenerateOption
+	}{
+		{"override after", []GenerateOption{WithGenerationConfig(base), WithTemperature(0.9)}},
+		{"override before", []GenerateOption{WithTemperature(0.9), WithGenerationConfig(base)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mustNew(t, "key", WithDoer(&mockDoer{}))
+			req, err := c.BuildRequest("test", tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			gc := req.GenerationConfig
+			if *gc.Temperature != 0.9 {
+				t.Errorf("temperature: got %v, want explicit 0.9", *gc.Temperature)
+			}
+			if gc.MaxOutputTokens != 512 || gc.ResponseMimeType != "application/json" || gc.CandidateCount != 2 {
+				t.Errorf("baseline fields not applied: %+v", gc)
+			}
+		})
+	}
+}
+
+func TestWithGenerationConfig_Validated(t *testing.T) {
+	temp := 5.0
+	c := mustNew(t, "key", WithDoer(&mockDoer{}))
+	if _, err := c.BuildRequest("test", WithGenerationConfig(GenerationConfig{Temperature: &temp})); err == nil {
+		t.Error("expected temperature validation error from the baseline config")
+	}
+}
+
+// --- DoerFunc ---
+
+func TestDoerFunc(t *testing.T) {
+	var gotPath string
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		gotPath = req.URL.Path
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(okBody))}, nil
+	})
+	c := mustNew(t, "key", WithDoer(doer), WithBaseURL("https://api.test"), WithModel("m"))
+
+	resp, err := c.Generate(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Text() != "ok" {
+		t.Errorf("Text(): got %q", resp.Text())
+	}
+	if gotPath != "/m:generateContent" {
+		t.Errorf("path: got %q", gotPath)
+	}
+}
+
+// --- Close ---
+
+func TestClose_Idempotent(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"default client", nil},
+		{"custom doer", []Option{WithDoer(&mockDoer{})}},
+		{"with cache and retry", []Option{WithCache(4, 0), WithRetry(1, time.Millisecond)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mustNew(t, "key", tt.opts...)
+			if err := c.Close(); err != nil {
+				t.Fatalf("first Close: %v", err)
+			}
+			if err := c.Close(); err != nil {
+				t.Fatalf("second Close: %v", err)
+			}
+		})
+	}
+}
+
+func TestClose_ClearsCache(t *testing.T) {
+	doer := &countDoer{}
+	c := mustNew(t, "key", WithDoer(doer), WithCache(4, 0))
+
+	_, _ = c.Generate(context.Background(), "p")
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	_, _ = c.Generate(context.Background(), "p")
+	if n := doer.calls.Load(); n != 2 {
+		t.Errorf("Doer calls: got %d, want 2 after Close cleared the cache", n)
+	}
+}
+
+func TestClose_ClosesIdleConnections(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, okBody)
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			select {
+			case closed <- struct{}{}:
+			default:
+			}
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	c := mustNew(t, "key", WithBaseURL(srv.URL))
+	c.httpClient.Transport = srv.Client().Transport
+	if _, err := c.Generate(context.Background(), "p"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle connection was not closed")
+	}
+}
+
+// --- Safety errors ---
+
+const safetyBody = `{"candidates":[{"content":{"parts":[]},"finishReason":"SAFETY","safetyRatings":[
+	{"category":"HARM_CATEGORY_HARASSMENT","probability":"NEGLIGIBLE"},
+	{"category":"HARM_CATEGORY_DANGEROUS_CONTENT","probability":"HIGH","blocked":true}]}]}`
+
+func TestGenerate_SafetyFinishReturnsResponseByDefault(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: safetyBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	resp, err := c.Generate(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Candidates[0].FinishReason != "SAFETY" {
+		t.Errorf("finishReason: got %q", resp.Candidates[0].FinishReason)
+	}
+}
+
+func TestGenerate_WithErrorOnSafety(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: safetyBody}
+	c := mustNew(t, "key", WithDoer(mock), WithCache(4, 0))
+
+	// The second call is a cache hit and must still report the block.
+	for i := range 2 {
+		_, err := c.Generate(context.Background(), "test", WithErrorOnSafety())
+		var se *SafetyError
+		if !errors.As(err, &se) {
+			t.Fatalf("call %d: expected *SafetyError, got %v", i+1, err)
+		}
+		if len(se.Ratings) != 1 || se.Ratings[0].Category != HarmCategoryDangerousContent {
+			t.Errorf("call %d: ratings: got %+v", i+1, se.Ratings)
+		}
+		if se.Response == nil {
+			t.Errorf("call %d: response should be attached", i+1)
+		}
+		if !strings.Contains(err.Error(), "HARM_CATEGORY_DANGEROUS_CONTENT (HIGH)") {
+			t.Errorf("call %d: message: got %q", i+1, err.Error())
+		}
+	}
+}
+
+func TestGenerate_WithErrorOnSafetyIgnoresOtherReasons(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	if _, err := c.Generate(context.Background(), "test", WithErrorOnSafety()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSafetyError_NoBlockedFlag(t *testing.T) {
+	resp := &Response{Candidates: []Candidate{{
+		FinishReason:  "SAFETY",
+		SafetyRatings: []SafetyRating{{Category: HarmCategoryHarassment, Probability: ProbabilityMedium}},
+	}}}
+	se := newSafetyError(resp)
+	if len(se.Ratings) != 1 || se.Ratings[0].Category != HarmCategoryHarassment {
+		t.Errorf("expected all ratings when none is marked blocked, got %+v", se.Ratings)
+	}
+}
+
+// --- Recitation errors ---
+
+const recitationBody = `{"candidates":[{"content":{"role":"model","parts":[{"text":"It was the best of times"}]},"finishReason":"RECITATION",
+	"citationMetadata":{"citationSources":[{"uri":"https://example.com/book"}]}}]}`
+
+func TestGenerate_WithErrorOnRecitation(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: recitationBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	resp, err := c.Generate(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("recitation should only fail when opted in, got: %v", err)
+	}
+	if resp.Candidates[0].FinishReason != FinishReasonRecitation {
+		t.Errorf("finishReason: got %q", resp.Candidates[0].FinishReason)
+	}
+
+	_, err = c.Generate(context.Background(), "test", WithErrorOnRecitation())
+	if !errors.Is(err, ErrRecitation) {
+		t.Fatalf("expected ErrRecitation, got %v", err)
+	}
+	var re *ResponseError
+	if !errors.As(err, &re) {
+		t.Fatalf("expected *ResponseError, got %T", err)
+	}
+	if re.Candidate == nil || re.Candidate.Text() != "It was the best of times" {
+		t.Errorf("candidate: got %+v", re.Candidate)
+	}
+	if re.Response == nil || re.Candidate != &re.Response.Candidates[0] {
+		t.Error("candidate should point into the attached response")
+	}
+}
+
+func TestGenerate_WithErrorOnRecitationIgnoresOtherReasons(t *testing.T) {
+	for _, body := range []string{okBody, safetyBody} {
+		mock := &mockDoer{statusCode: 200, respBody: body}
+		c := mustNew(t, "key", WithDoer(mock))
+
+		if _, err := c.Generate(context.Background(), "test", WithErrorOnRecitation()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func gunzip(t *testing.T, b []byte) []byte {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("gunzip: %v", err)
+	}
+	return out
+}
+
+func TestWithRequestGzip_CompressesLargeBody(t *testing.T) {
+	prompt := strings.Repeat("compress me ", 200)
+	doer := &mockDoer{statusCode: 200, respBody: `{"candidates":[{"content":{"parts":[{"text":"ok"}]}}]}`}
+	c := mustNew(t, "key", WithDoer(doer), WithRequestGzip())
+
+	if _, err := c.Generate(context.Background(), prompt); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := doer.req.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding: got %q, want gzip", got)
+	}
+	req, err := c.BuildRequest(prompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gunzip(t, doer.body); !bytes.Equal(got, want) {
+		t.Errorf("decompressed body mismatch:\n got %s\nwant %s", got, want)
+	}
+	if len(doer.body) >= len(want) {
+		t.Errorf("compressed body (%d bytes) not smaller than original (%d bytes)", len(doer.body), len(want))
+	}
+}
+
+func TestWithRequestGzip_SmallBodyUncompressed(t *testing.T) {
+	doer := &mockDoer{statusCode: 200, respBody: `{"candidates":[{"content":{"parts":[{"text":"ok"}]}}]}`}
+	c := mustNew(t, "key", WithDoer(doer), WithRequestGzip())
+
+	if _, err := c.Generate(context.Background(), "hi"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := doer.req.Header.Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding: got %q, want none", got)
+	}
+	if !json.Valid(doer.body) {
+		t.Errorf("expected plain JSON body, got %q", doer.body)
+	}
+}
+
+func TestWithRequestGzip_RetryReplaysCompressedBody(t *testing.T) {
+	prompt := strings.Repeat("retry me ", 200)
+	doer := &statusDoer{statuses: []int{503, 200}}
+	c := mustNew(t, "key", WithDoer(doer), WithRequestGzip(), WithRetry(1, time.Millisecond))
+
+	if _, err := c.Generate(context.Background(), prompt); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(doer.bodies) != 2 {
+		t.Fatalf("attempts: got %d, want 2", len(doer.bodies))
+	}
+	for i, b := range doer.bodies {
+		if got := gunzip(t, []byte(b)); !strings.Contains(string(got), "retry me") {
+			t.Errorf("attempt %d body not replayed: %q", i+1, got)
+		}
+	}
+}
+
+type fakeGenerator struct{ text string }
+
+func (f fakeGenerator) Generate(context.Context, string, ...GenerateOption) (*Response, error) {
+	return &Response{Candidates: []Candidate{{Content: ResponseContent{Parts: []ResponsePart{{Text: f.text}}}}}}, nil
+}
+
+func TestGenerator_Fake(t *testing.T) {
+	summarize := func(g Generator) string {
+		resp, err := g.Generate(context.Background(), "summarize")
+		if err != nil {
+			return err.Error()
+		}
+		return resp.Text()
+	}
+	if got := summarize(fakeGenerator{text: "faked"}); got != "faked" {
+		t.Errorf("got %q, want faked", got)
+	}
+}
@@ -0,0 +1,34 @@
+package gemini
+
+import (
+	"context"
+	"time"
+)
+
+// clock abstracts time so retry backoff and expiry can be tested without
+// waiting on the wall clock.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the default clock, backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// withClock replaces the client's clock. It is a test hook.
+func withClock(clk clock) Option {
+	return func(c *Client) { c.clock = clk }
+}
+
+// sleep waits for d on clk or until ctx is done.
+func sleep(ctx context.Context, clk clock, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-clk.After(d):
+		return nil
+	}
+}
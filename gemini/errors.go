@@ -0,0 +1,140 @@
+package gemini
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoCandidates is returned when a successful response contains no
+// candidates and no prompt block reason, which would otherwise be
+// indistinguishable from a valid empty answer.
+var ErrNoCandidates = errors.New("gemini: response contained no candidates")
+
+// ErrPromptTooLarge is returned by WithTokenGuard when the counted prompt
+// tokens exceed the guard's limit. No generation call is made. SplitByTokens
+// also returns it when a single character exceeds the chunk budget.
+var ErrPromptTooLarge = errors.New("gemini: prompt too large")
+
+// ErrStreamIdle is returned by GenerateStreamCallback when no line arrives
+// within the WithStreamIdleTimeout window.
+var ErrStreamIdle = errors.New("gemini: stream idle timeout")
+
+// ErrInvalidAPIKey is returned by VerifyAPIKey when the API rejects the key
+// with 401 or 403. The *APIError remains available via errors.As.
+var ErrInvalidAPIKey = errors.New("gemini: invalid API key")
+
+// ErrBlocked is returned with WithStrictPromptFeedback, wrapped in a
+// *ResponseError, when the response reports a prompt block reason.
+var ErrBlocked = errors.New("gemini: prompt blocked")
+
+// ErrModelNotFound is returned when the API answers 404 NOT_FOUND for the
+// requested model, usually a misspelled or retired model name. The error
+// names the model, and the *APIError remains available via errors.As.
+var ErrModelNotFound = errors.New("gemini: model not found")
+
+// ErrRecitation is returned with WithErrorOnRecitation, wrapped in a
+// *ResponseError, when the first candidate finished with reason RECITATION
+// because its output too closely matched existing content.
+var ErrRecitation = errors.New("gemini: candidate blocked for recitation")
+
+// ErrNoRecording is returned by a client using WithReplay when no recorded
+// exchange matches a request.
+var ErrNoRecording = errors.New("gemini: no recorded exchange for request")
+
+// APIError describes an HTTP error status from the API. It is the cause of
+// the dependency error returned by Generate, so match it with errors.As.
+// Fields come from the Google JSON error envelope when present; for other
+// bodies, such as an HTML page from a proxy, Message holds the truncated raw
+// body and Status is empty.
+type APIError struct {
+	StatusCode int               // HTTP status code
+	Status     string            // canonical status, e.g. "INVALID_ARGUMENT"
+	Message    string            // error message
+	Details    []json.RawMessage // structured details, if any
+	// QuotaExhausted is set on a 429 whose details report a daily quota
+	// violation. Unlike a per-minute rate limit it will not clear within
+	// seconds, so WithRetry does not retry it.
+	QuotaExhausted bool
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("gemini: HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// quotaExhausted reports whether error details include a
+// google.rpc.QuotaFailure violation of a per-day quota, such as
+// "GenerateRequestsPerDayPerProjectPerModel-FreeTier". Per-minute violations
+// are ordinary rate limits.
+func quotaExhausted(details []json.RawMessage) bool {
+	for _, raw := range details {
+		var d struct {
+			Type       string `json:"@type"`
+			Violations []struct {
+				QuotaID     string `json:"quotaId"`
+				QuotaMetric string `json:"quotaMetric"`
+			} `json:"violations"`
+		}
+		if json.Unmarshal(raw, &d) != nil || !strings.HasSuffix(d.Type, "google.rpc.QuotaFailure") {
+			continue
+		}
+		for _, v := range d.Violations {
+			if strings.Contains(strings.ToLower(v.QuotaID+" "+v.QuotaMetric), "perday") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SafetyError is returned with WithErrorOnSafety when the first candidate
+// finished with reason SAFETY. Ratings holds the ratings that blocked it, or
+// all of the candidate's ratings if none is marked blocked.
+type SafetyError struct {
+	Ratings  []SafetyRating
+	Response *Response
+}
+
+func newSafetyError(resp *Response) *SafetyError {
+	all := resp.Candidates[0].SafetyRatings
+	var blocked []SafetyRating
+	for _, r := range all {
+		if r.Blocked {
+			blocked = append(blocked, r)
+		}
+	}
+	if len(blocked) == 0 {
+		blocked = all
+	}
+	return &SafetyError{Ratings: blocked, Response: resp}
+}
+
+func (e *SafetyError) Error() string {
+	if len(e.Ratings) == 0 {
+		return "gemini: candidate blocked by safety filters"
+	}
+	cats := make([]string, len(e.Ratings))
+	for i, r := range e.Ratings {
+		cats[i] = fmt.Sprintf("%s (%s)", r.Category, r.Probability)
+	}
+	return "gemini: candidate blocked by safety filters: " + strings.Join(cats, ", ")
+}
+
+// ResponseError reports a successful HTTP response that the client rejected.
+// The parsed Response remains available for inspection, e.g. its UsageMetadata:
+//
+//	var re *gemini.ResponseError
+//	if errors.As(err, &re) {
+//		log.Print(re.Response.UsageMetadata.TotalTokenCount)
+//	}
+type ResponseError struct {
+	Err      error
+	Response *Response
+	// Candidate is the offending candidate, when the error concerns one.
+	Candidate *Candidate
+}
+
+func (e *ResponseError) Error() string { return e.Err.Error() }
+
+func (e *ResponseError) Unwrap() error { return e.Err }
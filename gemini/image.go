@@ -0,0 +1,60 @@
+package gemini
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	chassiserrors "github.com/ai8future/chassis-go/v11/errors"
+)
+
+// FetchImagePart downloads the image at rawURL with the client's Doer and
+// returns it as an inline-data part, ready for WithParts. The MIME type comes
+// from the Content-Type header when it names an image, and is otherwise
+// sniffed from the bytes; anything that is not an image is rejected, as are
+// images whose base64 encoding would exceed the 20 MB inline limit. The API
+// key is not sent. Only WithTimeout applies to the download; WithRetry,
+// WithRateLimit, WithRecorder, and WithReplay are for API calls and do not.
+func (c *Client) FetchImagePart(ctx context.Context, rawURL string) (Part, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return Part{}, chassiserrors.ValidationError(fmt.Sprintf("gemini: invalid image URL %q", rawURL))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Part{}, fmt.Errorf("gemini: create request: %w", err)
+	}
+	req.Header.Set("Accept", "image/*")
+
+	resp, err := c.fetchDoer.Do(req)
+	if err != nil {
+		return Part{}, chassiserrors.DependencyError(fmt.Sprintf("gemini: fetch image: %v", err)).WithCause(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return Part{}, chassiserrors.DependencyError(fmt.Sprintf("gemini: fetch image %s: HTTP %d", u.Redacted(), resp.StatusCode))
+	}
+
+	limit := base64.StdEncoding.DecodedLen(maxInlineBytes)
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if err != nil {
+		return Part{}, chassiserrors.DependencyError(fmt.Sprintf("gemini: fetch image: %v", err)).WithCause(err)
+	}
+	if len(data) > limit {
+		return Part{}, chassiserrors.ValidationError(fmt.Sprintf("gemini: image at %s exceeds the %d byte inline limit; upload it with the File API and use WithFile", u.Redacted(), limit))
+	}
+
+	mimeType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mimeType, "image/") {
+		mimeType, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+	if !strings.HasPrefix(mimeType, "image/") {
+		return Part{}, chassiserrors.ValidationError(fmt.Sprintf("gemini: %s is not an image (content type %q)", u.Redacted(), resp.Header.Get("Content-Type")))
+	}
+	return NewInlineDataPart(mimeType, data), nil
+}
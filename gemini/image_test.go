@@ -0,0 +1,130 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tinyPNG is a 1x1 transparent PNG.
+var tinyPNG, _ = base64.StdEncoding.DecodeString("iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAQAAAC1HAwCAAAAC0lEQVR42mNkYAAAAAYAAjCB0C8AAAAASUVORK5CYII=")
+
+// assetDoer serves body with contentType and records the request.
+type assetDoer struct {
+	req         *http.Request
+	status      int
+	contentType string
+	body        []byte
+}
+
+func (d *assetDoer) Do(req *http.Request) (*http.Response, error) {
+	d.req = req
+	status := d.status
+	if status == 0 {
+		status = 200
+	}
+	h := http.Header{}
+	if d.contentType != "" {
+		h.Set("Content-Type", d.contentType)
+	}
+	return &http.Response{StatusCode: status, Header: h, Body: io.NopCloser(bytes.NewReader(d.body))}, nil
+}
+
+func TestFetchImagePart(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+	}{
+		{"declared", "image/png"},
+		{"sniffed", ""},
+		{"generic header", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doer := &assetDoer{contentType: tt.contentType, body: tinyPNG}
+			c := mustNew(t, "secret-key", WithDoer(doer))
+
+			part, err := c.FetchImagePart(context.Background(), "https://images.example.com/dot.png")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if part.InlineData == nil || part.InlineData.MimeType != "image/png" {
+				t.Fatalf("part: got %+v", part)
+			}
+			if data, _ := part.InlineData.Decode(); !bytes.Equal(data, tinyPNG) {
+				t.Error("image bytes not preserved")
+			}
+			if doer.req.Header.Get("x-goog-api-key") != "" {
+				t.Error("the API key must not be sent to third-party hosts")
+			}
+		})
+	}
+}
+
+func TestFetchImagePart_Attach(t *testing.T) {
+	doer := &assetDoer{contentType: "image/png", body: tinyPNG}
+	c := mustNew(t, "key", WithDoer(doer))
+	part, err := c.FetchImagePart(context.Background(), "https://images.example.com/dot.png")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+
+	req, err := c.BuildRequest("describe", WithParts(part))
+	if err != nil {
+		t.Fatalf("BuildRequest: %v", err)
+	}
+	parts := req.Contents[0].Parts
+	if len(parts) != 2 || parts[0].Text != "describe" || parts[1].InlineData == nil {
+		t.Errorf("parts: got %+v", parts)
+	}
+}
+
+func TestFetchImagePart_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		doer    *assetDoer
+		wantErr string
+	}{
+		{"not an image", "https://example.com/", &assetDoer{contentType: "text/html", body: []byte("<html>hi</html>")}, "not an image"},
+		{"http error", "https://example.com/x.png", &assetDoer{status: 404}, "HTTP 404"},
+		{"too large", "https://example.com/big.png", &assetDoer{contentType: "image/png", body: make([]byte, maxInlineBytes)}, "inline limit"},
+		{"bad scheme", "ftp://example.com/x.png", &assetDoer{}, "invalid image URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mustNew(t, "key", WithDoer(tt.doer))
+			_, err := c.FetchImagePart(context.Background(), tt.url)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFetchImagePart_BypassesAPIStack(t *testing.T) {
+	calls := 0
+	doer := DoerFunc(func(*http.Request) (*http.Response, error) {
+		calls++
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+	})
+	clk := newFakeClock()
+	c := mustNew(t, "key", WithDoer(doer), WithRetry(3, time.Hour), WithRateLimit(1, 1),
+		WithReplay(t.TempDir()), WithTimeout(time.Second), withClock(clk))
+
+	_, err := c.FetchImagePart(context.Background(), "https://example.com/x.png")
+	if err == nil || !strings.Contains(err.Error(), "HTTP 503") {
+		t.Fatalf("expected the 503 from the image host, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls: got %d, want 1 (no retries, no replay)", calls)
+	}
+	if len(clk.sleeps) != 0 {
+		t.Errorf("sleeps: got %v, want none", clk.sleeps)
+	}
+}
@@ -0,0 +1,59 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// maxJSONSnippet bounds how much of the offending text a JSON error quotes.
+const maxJSONSnippet = 200
+
+// GenerateJSON calls Generate with WithJSONOutput and unmarshals the response
+// text into a T using Response.JSON. The raw response is returned alongside
+// the value, including when unmarshaling fails, so usage metadata remains
+// available.
+func GenerateJSON[T any](ctx context.Context, c *Client, prompt string, opts ...GenerateOption) (T, *Response, error) {
+	var v T
+	resp, err := c.Generate(ctx, prompt, append(opts[:len(opts):len(opts)], WithJSONOutput())...)
+	if err != nil {
+		return v, resp, err
+	}
+	if err := resp.JSON(&v); err != nil {
+		return *new(T), resp, err
+	}
+	return v, resp, nil
+}
+
+// JSON unmarshals the first candidate's text into v, stripping a surrounding
+// markdown code fence (such as "```json") if present. The error quotes a
+// snippet of the text when it is not valid JSON.
+func (r *Response) JSON(v any) error {
+	text := stripCodeFence(r.Text())
+	if err := json.Unmarshal([]byte(text), v); err != nil {
+		snippet := text
+		if len(snippet) > maxJSONSnippet {
+			snippet = snippet[:maxJSONSnippet] + "..."
+		}
+		return fmt.Errorf("gemini: unmarshal JSON output: %w (text: %q)", err, snippet)
+	}
+	return nil
+}
+
+// stripCodeFence removes a surrounding markdown code fence, such as
+// "```json\n...\n```", returning the inner text.
+func stripCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	s = strings.TrimPrefix(s, "```")
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	} else {
+		s = ""
+	}
+	s = strings.TrimSpace(s)
+	return strings.TrimSpace(strings.TrimSuffix(s, "```"))
+}
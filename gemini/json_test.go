@@ -0,0 +1,130 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type weather struct {
+	City  string  `json:"city"`
+	TempC float64 `json:"temp_c"`
+}
+
+func textBody(t *testing.T, text string) string {
+	t.Helper()
+	b, err := json.Marshal(Response{
+		Candidates:    []Candidate{{Content: ResponseContent{Parts: []ResponsePart{{Text: text}}}}},
+		UsageMetadata: UsageMetadata{TotalTokenCount: 12},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestGenerateJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"plain", `{"city":"Oslo","temp_c":4.5}`},
+		{"fenced", "```json\n{\"city\":\"Oslo\",\"temp_c\":4.5}\n```"},
+		{"bare fence", "```\n{\"city\":\"Oslo\",\"temp_c\":4.5}\n```\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockDoer{statusCode: 200, respBody: textBody(t, tt.text)}
+			c := mustNew(t, "key", WithDoer(mock))
+
+			got, resp, err := GenerateJSON[weather](context.Background(), c, "weather in Oslo")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != (weather{City: "Oslo", TempC: 4.5}) {
+				t.Errorf("got %+v", got)
+			}
+			if resp == nil || resp.UsageMetadata.TotalTokenCount != 12 {
+				t.Errorf("expected raw response with usage, got %+v", resp)
+			}
+			if !strings.Contains(string(mock.body), `"responseMimeType":"application/json"`) {
+				t.Errorf("JSON output mode not enabled: %s", mock.body)
+			}
+		})
+	}
+}
+
+func TestGenerateJSON_InvalidJSON(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: textBody(t, "not json")}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	got, resp, err := GenerateJSON[weather](context.Background(), c, "test")
+	if err == nil || !strings.Contains(err.Error(), "unmarshal JSON output") {
+		t.Fatalf("expected unmarshal error, got %v", err)
+	}
+	if got != (weather{}) {
+		t.Errorf("expected zero value, got %+v", got)
+	}
+	if resp == nil {
+		t.Error("raw response should be returned on unmarshal failure")
+	}
+}
+
+func TestGenerate_JSONOutputOmittedByDefault(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	_, _ = c.Generate(context.Background(), "test")
+
+	if strings.Contains(string(mock.body), "responseMimeType") {
+		t.Errorf("responseMimeType should be omitted, got %s", mock.body)
+	}
+}
+
+func TestResponseJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    weather
+		wantErr string
+	}{
+		{"unfenced", `{"city":"Oslo","temp_c":4.5}`, weather{"Oslo", 4.5}, ""},
+		{"fenced", "```json\n{\"city\":\"Oslo\",\"temp_c\":4.5}\n```", weather{"Oslo", 4.5}, ""},
+		{"fenced with whitespace", "\n  ```JSON\n{\"city\":\"Rome\"}\n```  \n", weather{City: "Rome"}, ""},
+		{"malformed", `{"city": "Oslo",`, weather{}, `(text: "{\"city\": \"Oslo\",")`},
+		{"empty", "", weather{}, "unmarshal JSON output"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &Response{Candidates: []Candidate{{Content: ResponseContent{Parts: []ResponsePart{{Text: tt.text}}}}}}
+			var got weather
+			err := resp.JSON(&got)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponseJSON_TruncatesSnippet(t *testing.T) {
+	text := strings.Repeat("x", 1000)
+	resp := &Response{Candidates: []Candidate{{Content: ResponseContent{Parts: []ResponsePart{{Text: text}}}}}}
+
+	err := resp.JSON(&weather{})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if strings.Contains(err.Error(), text) || !strings.Contains(err.Error(), "...") {
+		t.Errorf("snippet should be truncated, got %d-byte error", len(err.Error()))
+	}
+}
@@ -0,0 +1,141 @@
+package gemini
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// jsonStreamChecker accumulates streamed text and reports, once, the first
+// point at which it stops being a valid prefix of a JSON value matching
+// schema. It implements WithStreamJSONCheck.
+type jsonStreamChecker struct {
+	schema    *Schema
+	onInvalid func(offset int, err error)
+
+	buf      strings.Builder
+	reported bool
+}
+
+func (j *jsonStreamChecker) add(text string) {
+	if j.reported {
+		return
+	}
+	j.buf.WriteString(text)
+	if offset, err := checkJSONPrefix(j.buf.String(), j.schema); err != nil {
+		j.reported = true
+		j.onInvalid(offset, err)
+	}
+}
+
+// jsonFrame tracks an open object or array while walking JSON tokens.
+type jsonFrame struct {
+	schema    *Schema
+	object    bool
+	expectKey bool
+	value     *Schema // schema of the value following the current key
+}
+
+// checkJSONPrefix reports the byte offset and reason at which s stops being
+// a valid JSON prefix, or stops matching schema's property names, types, and
+// string enums.
+// Input that is merely incomplete is valid. A nil schema checks syntax only.
+func checkJSONPrefix(s string, schema *Schema) (int, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var stack []*jsonFrame
+	for {
+		offset := int(dec.InputOffset())
+		tok, err := dec.Token()
+		if err != nil {
+			var se *json.SyntaxError
+			if errors.As(err, &se) {
+				return int(se.Offset), fmt.Errorf("gemini: streamed JSON: %w", err)
+			}
+			return 0, nil // end of input, possibly mid-value: a valid prefix
+		}
+
+		var top *jsonFrame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+		if d, ok := tok.(json.Delim); ok && (d == '}' || d == ']') {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		if top != nil && top.expectKey {
+			key := tok.(string)
+			top.expectKey = false
+			top.value = nil
+			if top.schema != nil && len(top.schema.Properties) > 0 {
+				if top.value = top.schema.Properties[key]; top.value == nil {
+					return offset, fmt.Errorf("gemini: streamed JSON: property %q not in schema", key)
+				}
+			}
+			continue
+		}
+
+		want := schema
+		switch {
+		case top == nil:
+		case top.object:
+			want = top.value
+			top.expectKey = true
+		case top.schema != nil:
+			want = top.schema.Items
+		default:
+			want = nil
+		}
+		if want != nil && !jsonTokenMatches(tok, want.Type) {
+			return offset, fmt.Errorf("gemini: streamed JSON: got %s, schema wants %s", jsonTokenKind(tok), want.Type)
+		}
+		if str, ok := tok.(string); ok && want != nil && len(want.Enum) > 0 && !slices.Contains(want.Enum, str) {
+			return offset, fmt.Errorf("gemini: streamed JSON: %q is not one of the schema's enum values", str)
+		}
+		if d, ok := tok.(json.Delim); ok {
+			stack = append(stack, &jsonFrame{schema: want, object: d == '{', expectKey: d == '{'})
+		}
+	}
+}
+
+// jsonTokenMatches reports whether tok can start a value of the schema type.
+// Null and unknown types always match.
+func jsonTokenMatches(tok json.Token, typ string) bool {
+	switch strings.ToUpper(typ) {
+	case "OBJECT", "ARRAY", "STRING", "NUMBER", "INTEGER", "BOOLEAN":
+	default:
+		return true
+	}
+	if tok == nil {
+		return true
+	}
+	kind := jsonTokenKind(tok)
+	if strings.EqualFold(typ, "NUMBER") && kind == "INTEGER" {
+		return true
+	}
+	return strings.EqualFold(typ, kind)
+}
+
+// jsonTokenKind names the schema type of a value-starting token.
+func jsonTokenKind(tok json.Token) string {
+	switch v := tok.(type) {
+	case json.Delim:
+		if v == '{' {
+			return "OBJECT"
+		}
+		return "ARRAY"
+	case string:
+		return "STRING"
+	case json.Number:
+		if strings.ContainsAny(string(v), ".eE") {
+			return "NUMBER"
+		}
+		return "INTEGER"
+	case bool:
+		return "BOOLEAN"
+	default:
+		return "NULL"
+	}
+}
@@ -0,0 +1,128 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+var personSchema = &Schema{
+	Type: "OBJECT",
+	Properties: map[string]*Schema{
+		"name": {Type: "STRING"},
+		"age":  {Type: "INTEGER"},
+		"tags": {Type: "ARRAY", Items: &Schema{Type: "STRING"}},
+	},
+}
+
+func TestCheckJSONPrefix(t *testing.T) {
+	tests := []struct {
+		name       string
+		in         string
+		schema     *Schema
+		wantOffset int // -1 when valid
+	}{
+		{"empty", "", personSchema, -1},
+		{"open object", `{`, personSchema, -1},
+		{"partial key", `{"na`, personSchema, -1},
+		{"partial string value", `{"name":"Ad`, personSchema, -1},
+		{"partial literal", `{"name":"Ada","ok":tr`, nil, -1},
+		{"partial array", `{"tags":["a","b`, personSchema, -1},
+		{"complete", `{"name":"Ada","age":36,"tags":["x"]}`, personSchema, -1},
+		{"syntax error", `{"name" "Ada"}`, nil, 9},
+		{"wrong type", `{"name":"Ada","age":"old"}`, personSchema, 19},
+		{"wrong item type", `{"tags":["a",1]}`, personSchema, 12},
+		{"unknown property", `{"name":"Ada","nickname"`, personSchema, 13},
+		{"wrong root type", `["Ada"]`, personSchema, 0},
+		{"enum value", `"positive"`, EnumSchema("positive", "negative"), -1},
+		{"partial enum value", `"posi`, EnumSchema("positive", "negative"), -1},
+		{"not an enum value", `"neutral"`, EnumSchema("positive", "negative"), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, err := checkJSONPrefix(tt.in, tt.schema)
+			if tt.wantOffset < 0 {
+				if err != nil {
+					t.Fatalf("expected a valid prefix, got %v at %d", err, offset)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if offset != tt.wantOffset {
+				t.Errorf("offset: got %d, want %d (%v)", offset, tt.wantOffset, err)
+			}
+		})
+	}
+}
+
+func jsonStream(fragments ...string) []string {
+	events := make([]string, len(fragments))
+	for i, f := range fragments {
+		text, _ := json.Marshal(f)
+		events[i] = `{"candidates":[{"content":{"role":"model","parts":[{"text":` + string(text) + `}]}}]}`
+	}
+	return events
+}
+
+func TestGenerateStreamCallback_JSONCheckValidStream(t *testing.T) {
+	doer := &streamDoer{events: jsonStream(`{"name":"A`, `da","ag`, `e":36,"tags":[`, `"math"]}`)}
+	c := mustNew(t, "key", WithDoer(doer))
+
+	var reports []error
+	resp, err := c.GenerateStreamCallback(context.Background(), "who?", nil,
+		WithResponseSchema(personSchema),
+		WithStreamJSONCheck(func(offset int, err error) { reports = append(reports, err) }))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(reports) != 0 {
+		t.Errorf("valid stream should not be reported, got %v", reports)
+	}
+	var person struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+	if err := resp.JSON(&person); err != nil || person.Name != "Ada" || person.Age != 36 {
+		t.Errorf("final JSON: got %+v, %v", person, err)
+	}
+	body, err := doer.req.GetBody()
+	if err != nil {
+		t.Fatalf("GetBody: %v", err)
+	}
+	if sent, _ := io.ReadAll(body); !strings.Contains(string(sent), `"responseSchema"`) {
+		t.Errorf("request should carry the response schema: %s", sent)
+	}
+}
+
+func TestGenerateStreamCallback_JSONCheckReportsOnce(t *testing.T) {
+	doer := &streamDoer{events: jsonStream(`{"name":"Ada",`, `"age":"thirty`, `-six", "x":1}`)}
+	c := mustNew(t, "key", WithDoer(doer))
+
+	var offsets []int
+	if _, err := c.GenerateStreamCallback(context.Background(), "who?", nil,
+		WithResponseSchema(personSchema),
+		WithStreamJSONCheck(func(offset int, err error) { offsets = append(offsets, offset) })); err != nil {
+		t.Fatalf("check must not abort the stream, got %v", err)
+	}
+	if len(offsets) != 1 || offsets[0] != 19 {
+		t.Errorf("reports: got offsets %v, want [19]", offsets)
+	}
+}
+
+func TestGenerateStreamCallback_JSONCheckNeedsJSONMode(t *testing.T) {
+	doer := &streamDoer{events: helloStream}
+	c := mustNew(t, "key", WithDoer(doer))
+
+	called := false
+	if _, err := c.GenerateStreamCallback(context.Background(), "hi", nil,
+		WithStreamJSONCheck(func(int, error) { called = true })); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if called {
+		t.Error("plain text streams should not be checked")
+	}
+}
@@ -0,0 +1,40 @@
+package gemini
+
+import (
+	"math/rand/v2"
+	"sync"
+)
+
+// modelSplit picks one of two models per call for WithModelSplit.
+type modelSplit struct {
+	modelA, modelB string
+	ratioA         float64
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// WithModelSplit sends each call to modelA with probability ratioA and to
+// modelB otherwise, for comparing models on live traffic. The chosen model
+// is reported in Response.Model. A model set per call with WithRequestModel
+// or ContextWithModel bypasses the split; the client's own model (WithModel)
+// is not used by calls that go through it.
+func WithModelSplit(modelA, modelB string, ratioA float64) Option {
+	return func(c *Client) {
+		c.split = &modelSplit{
+			modelA: modelA,
+			modelB: modelB,
+			ratioA: ratioA,
+			rng:    rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+		}
+	}
+}
+
+func (s *modelSplit) pick() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rng.Float64() < s.ratioA {
+		return s.modelA
+	}
+	return s.modelB
+}
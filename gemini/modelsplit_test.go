@@ -0,0 +1,60 @@
+package gemini
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWithModelSplit_Ratio(t *testing.T) {
+	var lastPath string
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		lastPath = req.URL.Path
+		return (&mockDoer{statusCode: 200, respBody: okBody}).Do(req)
+	})
+	c := mustNew(t, "key", WithDoer(doer), WithModelSplit("gemini-2.5-flash", "gemini-2.5-pro", 0.3))
+	c.split.rng = rand.New(rand.NewPCG(1, 2))
+
+	const calls = 2000
+	counts := map[string]int{}
+	for range calls {
+		resp, err := c.Generate(context.Background(), "test")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(lastPath, "/"+resp.Model+":") {
+			t.Fatalf("Response.Model %q does not match request path %q", resp.Model, lastPath)
+		}
+		counts[resp.Model]++
+	}
+	if got := float64(counts["gemini-2.5-flash"]) / calls; math.Abs(got-0.3) > 0.03 {
+		t.Errorf("share of model A: got %.3f, want about 0.3 (%v)", got, counts)
+	}
+	if counts["gemini-2.5-flash"]+counts["gemini-2.5-pro"] != calls {
+		t.Errorf("unexpected models used: %v", counts)
+	}
+
+	resp, err := c.Generate(context.Background(), "test", WithRequestModel("gemini-2.0-flash"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Model != "gemini-2.0-flash" {
+		t.Errorf("per-call model should bypass the split, got %q", resp.Model)
+	}
+}
+
+func TestWithModelSplit_Invalid(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"bad model":      WithModelSplit("bad model", "gemini-2.5-pro", 0.5),
+		"negative ratio": WithModelSplit("gemini-2.5-flash", "gemini-2.5-pro", -0.1),
+		"ratio above 1":  WithModelSplit("gemini-2.5-flash", "gemini-2.5-pro", 1.5),
+		"NaN ratio":      WithModelSplit("gemini-2.5-flash", "gemini-2.5-pro", math.NaN()),
+	} {
+		if _, err := New("key", opt); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
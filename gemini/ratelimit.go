@@ -0,0 +1,69 @@
+package gemini
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rateLimitDoer wraps a Doer with a token bucket, delaying each request until
+// a token is available or the request context is done. It sits inside
+// retryDoer so every attempt, retries included, spends a token.
+type rateLimitDoer struct {
+	next  Doer
+	clock clock
+	rps   float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimitDoer(next Doer, clk clock, rps float64, burst int) *rateLimitDoer {
+	return &rateLimitDoer{
+		next:   next,
+		clock:  clk,
+		rps:    rps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   clk.Now(),
+	}
+}
+
+func (r *rateLimitDoer) Do(req *http.Request) (*http.Response, error) {
+	if wait := r.reserve(); wait > 0 {
+		if err := sleep(req.Context(), r.clock, wait); err != nil {
+			r.cancel()
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, err
+		}
+	}
+	return r.next.Do(req)
+}
+
+// reserve takes a token, letting the balance go negative, and returns how
+// long the caller must wait for that token to become available.
+func (r *rateLimitDoer) reserve() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.clock.Now()
+	if elapsed := now.Sub(r.last); elapsed > 0 {
+		r.tokens = min(r.burst, r.tokens+elapsed.Seconds()*r.rps)
+		r.last = now
+	}
+	r.tokens--
+	if r.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-r.tokens / r.rps * float64(time.Second))
+}
+
+// cancel returns a reserved token when its caller gives up waiting.
+func (r *rateLimitDoer) cancel() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens = min(r.burst, r.tokens+1)
+}
@@ -0,0 +1,99 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithRateLimit_SpacesRequests(t *testing.T) {
+	clk := newFakeClock()
+	doer := &statusDoer{statuses: []int{200}}
+	c := mustNew(t, "key", WithDoer(doer), WithRateLimit(2, 1), withClock(clk))
+
+	for range 4 {
+		if _, err := c.Generate(context.Background(), "test"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(doer.bodies) != 4 {
+		t.Fatalf("attempts: got %d, want 4", len(doer.bodies))
+	}
+	want := []time.Duration{500 * time.Millisecond, 500 * time.Millisecond, 500 * time.Millisecond}
+	if len(clk.sleeps) != len(want) {
+		t.Fatalf("sleeps: got %v, want %v", clk.sleeps, want)
+	}
+	for i, d := range clk.sleeps {
+		if d != want[i] {
+			t.Errorf("sleep %d: got %v, want %v", i, d, want[i])
+		}
+	}
+}
+
+func TestWithRateLimit_BurstAndRefill(t *testing.T) {
+	clk := newFakeClock()
+	doer := &statusDoer{statuses: []int{200}}
+	c := mustNew(t, "key", WithDoer(doer), WithRateLimit(1, 3), withClock(clk))
+
+	for range 3 {
+		if _, err := c.Generate(context.Background(), "test"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(clk.sleeps) != 0 {
+		t.Fatalf("burst should not wait, got sleeps %v", clk.sleeps)
+	}
+
+	clk.Advance(2 * time.Second)
+	for range 3 {
+		if _, err := c.Generate(context.Background(), "test"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(clk.sleeps) != 1 || clk.sleeps[0] != time.Second {
+		t.Errorf("sleeps after refill: got %v, want [1s]", clk.sleeps)
+	}
+}
+
+func TestWithRateLimit_ContextCancelledWhileWaiting(t *testing.T) {
+	doer := &statusDoer{statuses: []int{200}}
+	c := mustNew(t, "key", WithDoer(doer), WithRateLimit(0.001, 1))
+
+	if _, err := c.Generate(context.Background(), "first"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.Generate(ctx, "second")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("waiting should stop when the context is done")
+	}
+	if len(doer.bodies) != 1 {
+		t.Errorf("attempts: got %d, want 1", len(doer.bodies))
+	}
+}
+
+func TestWithRateLimit_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		rps   float64
+		burst int
+	}{
+		{"zero rps", 0, 1},
+		{"negative rps", -1, 1},
+		{"zero burst", 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New("key", WithRateLimit(tt.rps, tt.burst)); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
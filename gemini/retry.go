@@ -0,0 +1,175 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxRetryDelay caps a single backoff sleep, including server Retry-After hints.
+const maxRetryDelay = 30 * time.Second
+
+// retryDoer wraps a Doer, retrying 429, 5xx, and network errors with
+// exponential backoff and full jitter. A 429 reporting daily quota exhaustion
+// is returned at once. Request bodies are replayed via GetBody.
+// A WithCallTimeout deadline is applied to each attempt separately.
+type retryDoer struct {
+	next    Doer
+	retries int
+	base    time.Duration
+	clock   clock
+}
+
+func (r *retryDoer) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 {
+			var err error
+			if attemptReq, err = rewind(req); err != nil {
+				return nil, err
+			}
+		}
+
+		if n, ok := ctx.Value(attemptsKey{}).(*int); ok {
+			*n = attempt + 1
+		}
+		var cancel context.CancelFunc
+		if d := attemptTimeout(ctx); d > 0 {
+			var attemptCtx context.Context
+			attemptCtx, cancel = context.WithTimeout(ctx, d)
+			attemptReq = attemptReq.WithContext(attemptCtx)
+		}
+		resp, err := r.next.Do(attemptReq)
+		if attempt >= r.retries || !retryable(resp, err) || ctx.Err() != nil || quotaResponse(resp) {
+			if cancel != nil {
+				if err != nil {
+					cancel()
+				} else {
+					resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+				}
+			}
+			return resp, err
+		}
+
+		delay := r.backoff(attempt)
+		if resp != nil {
+			if ra, ok := retryAfter(resp.Header.Get("Retry-After"), r.clock.Now()); ok {
+				delay = ra
+			}
+			// Drain so the connection can be reused.
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBodyBytes))
+			resp.Body.Close()
+		}
+		if cancel != nil {
+			cancel()
+		}
+		if err := sleep(ctx, r.clock, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attemptsKey carries a counter the retry wrapper sets to the number of
+// attempts made, reported as Response.Attempts.
+type attemptsKey struct{}
+
+// EstimateMaxDuration returns the worst-case wall time of a request that
+// makes up to retries retries after the initial attempt, each bounded by
+// timeout, with the exponential backoff used by WithRetry between attempts.
+// Use it to size a context deadline that does not cut retries short. Server
+// Retry-After hints may extend each gap up to 30s and are not included.
+func EstimateMaxDuration(timeout time.Duration, retries int, base time.Duration) time.Duration {
+	retries = max(retries, 0)
+	total := timeout * time.Duration(retries+1)
+	for attempt := range retries {
+		total += backoffCeiling(base, attempt)
+	}
+	return total
+}
+
+// rewind returns a copy of req with a fresh body from GetBody.
+func rewind(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return clone, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("gemini: cannot replay request body for retry")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	clone.Body = body
+	return clone, nil
+}
+
+// retryable reports whether a response or transport error should be retried.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// maxQuotaPeekBytes bounds how much of a 429 body quotaResponse inspects.
+const maxQuotaPeekBytes = 64 << 10
+
+// quotaResponse reports whether resp is a 429 for an exhausted daily quota.
+// The peeked body is restored so the caller can still read it in full.
+func quotaResponse(resp *http.Response) bool {
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		return false
+	}
+	peek, _ := io.ReadAll(io.LimitReader(resp.Body, maxQuotaPeekBytes))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(peek), resp.Body), resp.Body}
+	return newAPIError(resp.StatusCode, peek).QuotaExhausted
+}
+
+// backoff returns a full-jitter delay in [0, base*2^attempt), capped at maxRetryDelay.
+func (r *retryDoer) backoff(attempt int) time.Duration {
+	ceiling := backoffCeiling(r.base, attempt)
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling)
+}
+
+// backoffCeiling returns base*2^attempt capped at maxRetryDelay, or 0 when
+// base is not positive.
+func backoffCeiling(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	ceiling := base << attempt
+	if ceiling <= 0 || ceiling > maxRetryDelay {
+		ceiling = maxRetryDelay
+	}
+	return ceiling
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+// relative to now.
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	var d time.Duration
+	if secs, err := strconv.Atoi(v); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = t.Sub(now)
+	} else {
+		return 0, false
+	}
+	return min(max(d, 0), maxRetryDelay), true
+}
@@ -0,0 +1,463 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statusDoer replies with the given status codes in order (the last one repeats)
+// and records the body of every attempt.
+type statusDoer struct {
+	statuses []int
+	header   http.Header
+	bodies   []string
+	errs     []error
+}
+
+func (s *statusDoer) Do(req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+	i := len(s.bodies)
+	s.bodies = append(s.bodies, string(body))
+	if i < len(s.errs) && s.errs[i] != nil {
+		return nil, s.errs[i]
+	}
+	code := s.statuses[min(i, len(s.statuses)-1)]
+	respBody := `{"candidates":[{"content":{"parts":[{"text":"ok"}]}}]}`
+	if code >= 400 {
+		respBody = `{"error":"` + http.StatusText(code) + `"}`
+	}
+	return &http.Response{
+		StatusCode: code,
+		Header:     s.header,
+		Body:       io.NopCloser(strings.NewReader(respBody)),
+	}, nil
+}
+
+func TestWithRetry_SuccessAfterTwo429s(t *testing.T) {
+	doer := &statusDoer{statuses: []int{429, 429, 200}}
+	c := mustNew(t, "key", WithDoer(doer), WithRetry(3, time.Millisecond))
+
+	resp, err := c.Generate(context.Background(), "retry me")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Text() != "ok" {
+		t.Errorf("Text(): got %q", resp.Text())
+	}
+	if len(doer.bodies) != 3 {
+		t.Fatalf("attempts: got %d, want 3", len(doer.bodies))
+	}
+	if resp.Attempts != 3 {
+		t.Errorf("Response.Attempts: got %d, want 3", resp.Attempts)
+	}
+	for i, b := range doer.bodies {
+		if !strings.Contains(b, "retry me") {
+			t.Errorf("attempt %d body not replayed: %q", i+1, b)
+		}
+	}
+}
+
+func TestResponse_AttemptsDefault(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"no retry":   nil,
+		"with retry": {WithRetry(3, time.Millisecond)},
+	} {
+		c := mustNew(t, "key", append(opts, WithDoer(&statusDoer{statuses: []int{200}}), WithCache(4, 0))...)
+		resp, err := c.Generate(context.Background(), "once")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if resp.Attempts != 1 {
+			t.Errorf("%s: Attempts: got %d, want 1", name, resp.Attempts)
+		}
+		if resp, _ = c.Generate(context.Background(), "once"); resp.Attempts != 0 {
+			t.Errorf("%s: cached Attempts: got %d, want 0", name, resp.Attempts)
+		}
+	}
+}
+
+func TestWithRetry_NonRetryable400(t *testing.T) {
+	doer := &statusDoer{statuses: []int{400, 200}}
+	c := mustNew(t, "key", WithDoer(doer), WithRetry(3, time.Millisecond))
+
+	_, err := c.Generate(context.Background(), "test")
+	if err == nil || !strings.Contains(err.Error(), "HTTP 400") {
+		t.Fatalf("expected HTTP 400 error, got %v", err)
+	}
+	if len(doer.bodies) != 1 {
+		t.Errorf("attempts: got %d, want 1", len(doer.bodies))
+	}
+}
+
+// quotaBody returns a 429 error envelope with a QuotaFailure violation of quotaID.
+func quotaBody(quotaID string) string {
+	return `{"error":{"code":429,"status":"RESOURCE_EXHAUSTED","message":"quota exceeded","details":[` +
+		`{"@type":"type.googleapis.com/google.rpc.QuotaFailure","violations":[` +
+		`{"quotaMetric":"generativelanguage.googleapis.com/generate_content_free_tier_requests","quotaId":"` + quotaID + `"}]}]}}`
+}
+
+func TestWithRetry_Quota429(t *testing.T) {
+	tests := map[string]struct {
+		quotaID   string
+		exhausted bool
+		attempts  int
+	}{
+		"per-minute rate limit": {"GenerateRequestsPerMinutePerProjectPerModel-FreeTier", false, 3},
+		"daily quota":           {"GenerateRequestsPerDayPerProjectPerModel-FreeTier", true, 1},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			attempts := 0
+			doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+				attempts++
+				return &http.Response{
+					StatusCode: http.StatusTooManyRequests,
+					Body:       io.NopCloser(strings.NewReader(quotaBody(tt.quotaID))),
+				}, nil
+			})
+			c := mustNew(t, "key", WithDoer(doer), WithRetry(2, time.Millisecond))
+
+			_, err := c.Generate(context.Background(), "test")
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected *APIError, got %v", err)
+			}
+			if apiErr.QuotaExhausted != tt.exhausted {
+				t.Errorf("QuotaExhausted: got %v, want %v", apiErr.QuotaExhausted, tt.exhausted)
+			}
+			if apiErr.Status != "RESOURCE_EXHAUSTED" || len(apiErr.Details) != 1 {
+				t.Errorf("body not preserved: %+v", apiErr)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("attempts: got %d, want %d", attempts, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestWithRetry_GivesUpAfterRetries(t *testing.T) {
+	doer := &statusDoer{statuses: []int{503}}
+	c := mustNew(t, "key", WithDoer(doer), WithRetry(2, time.Millisecond))
+
+	_, err := c.Generate(context.Background(), "test")
+	if err == nil || !strings.Contains(err.Error(), "HTTP 503") {
+		t.Fatalf("expected HTTP 503 error, got %v", err)
+	}
+	if len(doer.bodies) != 3 {
+		t.Errorf("attempts: got %d, want 3", len(doer.bodies))
+	}
+}
+
+func TestWithRetry_NetworkError(t *testing.T) {
+	doer := &statusDoer{statuses: []int{200}, errs: []error{io.ErrUnexpectedEOF}}
+	c := mustNew(t, "key", WithDoer(doer), WithRetry(1, time.Millisecond))
+
+	if _, err := c.Generate(context.Background(), "test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(doer.bodies) != 2 {
+		t.Errorf("attempts: got %d, want 2", len(doer.bodies))
+	}
+}
+
+func TestWithRetry_ContextCancelledDuringBackoff(t *testing.T) {
+	doer := &statusDoer{statuses: []int{429}, header: http.Header{"Retry-After": []string{"10"}}}
+	c := mustNew(t, "key", WithDoer(doer), WithRetry(3, time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.Generate(ctx, "test")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("backoff should stop when the context is done")
+	}
+	if len(doer.bodies) != 1 {
+		t.Errorf("attempts: got %d, want 1", len(doer.bodies))
+	}
+}
+
+func TestWithRetry_NegativeRejected(t *testing.T) {
+	if _, err := New("key", WithRetry(-1, time.Millisecond)); err == nil {
+		t.Fatal("expected error for negative retries")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"-5", 0, true},
+		{"3600", maxRetryDelay, true},
+		{"soon", 0, false},
+	}
+	now := newFakeClock().Now()
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.in, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("retryAfter(%q): got (%v, %v), want (%v, %v)", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	date := now.Add(2 * time.Second).Format(http.TimeFormat)
+	if d, ok := retryAfter(date, now); !ok || d != 2*time.Second {
+		t.Errorf("retryAfter(date): got (%v, %v), want (2s, true)", d, ok)
+	}
+}
+
+func TestRetryDoer_BackoffBounds(t *testing.T) {
+	r := &retryDoer{base: 100 * time.Millisecond}
+	for attempt := 0; attempt < 5; attempt++ {
+		ceiling := r.base << attempt
+		for i := 0; i < 50; i++ {
+			if d := r.backoff(attempt); d < 0 || d >= ceiling {
+				t.Fatalf("backoff(%d) = %v, want [0, %v)", attempt, d, ceiling)
+			}
+		}
+	}
+	if d := r.backoff(40); d >= maxRetryDelay {
+		t.Errorf("backoff should be capped at %v, got %v", maxRetryDelay, d)
+	}
+	if d := (&retryDoer{}).backoff(3); d != 0 {
+		t.Errorf("zero base should not sleep, got %v", d)
+	}
+}
+
+func TestEstimateMaxDuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		retries int
+		base    time.Duration
+		want    time.Duration
+	}{
+		{"no retries", 30 * time.Second, 0, time.Second, 30 * time.Second},
+		{"cli defaults", 30 * time.Second, 3, 500 * time.Millisecond, 120*time.Second + 3500*time.Millisecond},
+		{"backoff capped", 10 * time.Second, 3, 20 * time.Second, 40*time.Second + 20*time.Second + 2*maxRetryDelay},
+		{"zero base", 5 * time.Second, 2, 0, 15 * time.Second},
+		{"negative retries", 5 * time.Second, -1, time.Second, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateMaxDuration(tt.timeout, tt.retries, tt.base); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEstimateMaxDuration_BoundsRetrySequence(t *testing.T) {
+	const (
+		timeout = 30 * time.Second
+		retries = 4
+		base    = 2 * time.Second
+	)
+	limit := EstimateMaxDuration(timeout, retries, base)
+	for trial := range 200 {
+		clk := newFakeClock()
+		start := clk.Now()
+		attempts := 0
+		r := &retryDoer{
+			// Each attempt uses its full timeout before failing.
+			next: DoerFunc(func(*http.Request) (*http.Response, error) {
+				attempts++
+				clk.Advance(timeout)
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+			}),
+			retries: retries,
+			base:    base,
+			clock:   clk,
+		}
+		req, _ := http.NewRequest(http.MethodGet, "https://api.test", nil)
+		resp, err := r.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if attempts != retries+1 {
+			t.Fatalf("attempts: got %d, want %d", attempts, retries+1)
+		}
+		if elapsed := clk.Now().Sub(start); elapsed > limit {
+			t.Fatalf("trial %d: retry sequence took %v, over the estimate %v", trial, elapsed, limit)
+		}
+	}
+}
+
+func TestWithRetry_FakeClockBackoff(t *testing.T) {
+	clk := newFakeClock()
+	doer := &statusDoer{statuses: []int{503, 503, 503, 200}}
+	c := mustNew(t, "key", WithDoer(doer), WithRetry(3, time.Hour), withClock(clk))
+
+	start := time.Now()
+	if _, err := c.Generate(context.Background(), "test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("backoff should not wait on the wall clock")
+	}
+	if len(clk.sleeps) != 3 {
+		t.Fatalf("sleeps: got %d, want 3", len(clk.sleeps))
+	}
+	for i, d := range clk.sleeps {
+		if d < 0 || d >= maxRetryDelay {
+			t.Errorf("sleep %d = %v, want [0, %v)", i, d, maxRetryDelay)
+		}
+	}
+}
+
+func TestWithRetry_FakeClockRetryAfterDate(t *testing.T) {
+	clk := newFakeClock()
+	date := clk.Now().Add(7 * time.Second).Format(http.TimeFormat)
+	doer := &statusDoer{statuses: []int{429, 200}, header: http.Header{"Retry-After": {date}}}
+	c := mustNew(t, "key", WithDoer(doer), WithRetry(1, time.Millisecond), withClock(clk))
+
+	if _, err := c.Generate(context.Background(), "test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(clk.sleeps) != 1 || clk.sleeps[0] != 7*time.Second {
+		t.Errorf("sleeps: got %v, want [7s]", clk.sleeps)
+	}
+}
+
+// hangDoer blocks the first hangs attempts until their context is done and
+// answers later ones; it records each attempt's remaining time budget.
+type hangDoer struct {
+	hangs   int
+	budgets []time.Duration
+}
+
+func (h *hangDoer) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil, errors.New("attempt has no deadline")
+	}
+	h.budgets = append(h.budgets, time.Until(deadline))
+	if len(h.budgets) <= h.hangs {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(okBody))}, nil
+}
+
+func TestWithCallTimeout_PerAttempt(t *testing.T) {
+	doer := &hangDoer{hangs: 1}
+	c := mustNew(t, "key", WithDoer(doer), WithRetry(2, time.Millisecond))
+
+	start := time.Now()
+	resp, err := c.Generate(context.Background(), "test", WithCallTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("the retry after a timed-out attempt should succeed, got %v", err)
+	}
+	if resp.Text() != "ok" {
+		t.Errorf("text: got %q", resp.Text())
+	}
+	if len(doer.budgets) != 2 {
+		t.Fatalf("attempts: got %d, want 2", len(doer.budgets))
+	}
+	for i, b := range doer.budgets {
+		if b > 50*time.Millisecond {
+			t.Errorf("attempt %d budget %v exceeds the per-attempt timeout", i, b)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("first attempt should have run to its timeout, took %v", elapsed)
+	}
+}
+
+func TestWithCallTimeout_TotalBound(t *testing.T) {
+	doer := &hangDoer{hangs: 10}
+	c := mustNew(t, "key", WithDoer(doer), WithRetry(2, time.Millisecond))
+
+	start := time.Now()
+	_, err := c.Generate(context.Background(), "test", WithCallTimeout(20*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if len(doer.budgets) != 3 {
+		t.Errorf("attempts: got %d, want 3", len(doer.budgets))
+	}
+	if limit := EstimateMaxDuration(20*time.Millisecond, 2, time.Millisecond); time.Since(start) > limit+time.Second {
+		t.Errorf("call outlived its total bound %v", limit)
+	}
+
+	// The caller's context remains the overall deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	doer.budgets = nil
+	if _, err := c.Generate(ctx, "test", WithCallTimeout(time.Hour)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the caller's deadline to win, got %v", err)
+	}
+	if len(doer.budgets) != 1 {
+		t.Errorf("attempts after caller deadline: got %d, want 1", len(doer.budgets))
+	}
+}
+
+func TestWithCallTimeout_CoversRetryOnEmpty(t *testing.T) {
+	var calls int
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		switch calls {
+		case 1, 3: // time out, to be retried by WithRetry
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		case 2: // slow empty response, retried by WithRetryOnEmpty
+			time.Sleep(40 * time.Millisecond)
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"candidates":[]}`))}, nil
+		}
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(okBody))}, nil
+	})
+	c := mustNew(t, "key", WithDoer(doer), WithRetry(1, time.Millisecond))
+
+	// The two sequences take about 140ms, over one sequence's budget of
+	// EstimateMaxDuration(50ms, 1, 1ms).
+	resp, err := c.Generate(context.Background(), "test", WithCallTimeout(50*time.Millisecond), WithRetryOnEmpty(1))
+	if err != nil {
+		t.Fatalf("the second sequence should not be cut short, got %v", err)
+	}
+	if resp.Text() != "ok" || calls != 4 {
+		t.Errorf("got text %q after %d calls, want \"ok\" after 4", resp.Text(), calls)
+	}
+}
+
+func TestGenerateConfig_RequestSequences(t *testing.T) {
+	tests := []struct {
+		cfg  generateConfig
+		want int
+	}{
+		{generateConfig{}, 1},
+		{generateConfig{retryOnEmpty: 2}, 3},
+		{generateConfig{tokenGuard: 100}, 2},
+		{generateConfig{searchFallback: true}, 2},
+		{generateConfig{retryOnEmpty: 1, tokenGuard: 100, searchFallback: true}, 6},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.requestSequences(); got != tt.want {
+			t.Errorf("%+v: got %d, want %d", tt.cfg, got, tt.want)
+		}
+	}
+}
+
+func TestWithCallTimeout_NoRetry(t *testing.T) {
+	doer := &hangDoer{hangs: 1}
+	c := mustNew(t, "key", WithDoer(doer))
+
+	if _, err := c.Generate(context.Background(), "test", WithCallTimeout(10*time.Millisecond)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if _, err := c.Generate(context.Background(), "test", WithCallTimeout(-time.Second)); err == nil {
+		t.Error("expected error for negative call timeout")
+	}
+}
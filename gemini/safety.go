@@ -0,0 +1,74 @@
+package gemini
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	chassiserrors "github.com/ai8future/chassis-go/v11/errors"
+)
+
+// harmCategoryNames maps the short names accepted by SafetySettingsFromMap
+// to harm categories.
+var harmCategoryNames = map[string]string{
+	"harassment":        HarmCategoryHarassment,
+	"hate":              HarmCategoryHateSpeech,
+	"hate_speech":       HarmCategoryHateSpeech,
+	"sexual":            HarmCategorySexuallyExplicit,
+	"sexually_explicit": HarmCategorySexuallyExplicit,
+	"dangerous":         HarmCategoryDangerousContent,
+	"dangerous_content": HarmCategoryDangerousContent,
+	"civic":             HarmCategoryCivicIntegrity,
+	"civic_integrity":   HarmCategoryCivicIntegrity,
+}
+
+// harmBlockNames maps the short names accepted by SafetySettingsFromMap to
+// block thresholds.
+var harmBlockNames = map[string]string{
+	"block_none":   HarmBlockNone,
+	"block_high":   HarmBlockOnlyHigh,
+	"block_medium": HarmBlockMediumAndAbove,
+	"block_low":    HarmBlockLowAndAbove,
+	"off":          HarmBlockOff,
+}
+
+// SafetySettingsFromMap converts category=threshold pairs, e.g. from a config
+// file or environment variable, into safety settings ordered by category.
+// Categories are given as HarmCategory constants or short names (harassment,
+// hate, sexual, dangerous, civic); thresholds as HarmBlock constants or
+// short names (block_none, block_high, block_medium, block_low, off). Both
+// are case-insensitive. Unknown names are a validation error.
+func SafetySettingsFromMap(m map[string]string) ([]SafetySetting, error) {
+	settings := make([]SafetySetting, 0, len(m))
+	for k, v := range m {
+		cat, ok := lookupName(harmCategoryNames, k, harmCategories)
+		if !ok {
+			return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: unknown harm category %q", k))
+		}
+		threshold, ok := lookupName(harmBlockNames, v, []string{HarmBlockNone, HarmBlockOnlyHigh, HarmBlockMediumAndAbove, HarmBlockLowAndAbove, HarmBlockOff})
+		if !ok {
+			return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: unknown safety threshold %q for %s", v, k))
+		}
+		if slices.ContainsFunc(settings, func(s SafetySetting) bool { return s.Category == cat }) {
+			return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: harm category %s given more than once", cat))
+		}
+		settings = append(settings, SafetySetting{Category: cat, Threshold: threshold})
+	}
+	slices.SortFunc(settings, func(a, b SafetySetting) int {
+		return slices.Index(harmCategories, a.Category) - slices.Index(harmCategories, b.Category)
+	})
+	return settings, nil
+}
+
+// lookupName resolves name, ignoring case and surrounding space, as a short
+// name in aliases or one of the full constant values.
+func lookupName(aliases map[string]string, name string, values []string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if v, ok := aliases[strings.ToLower(name)]; ok {
+		return v, true
+	}
+	if i := slices.Index(values, strings.ToUpper(name)); i >= 0 {
+		return values[i], true
+	}
+	return "", false
+}
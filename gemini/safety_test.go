@@ -0,0 +1,36 @@
+package gemini
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSafetySettingsFromMap(t *testing.T) {
+	got, err := SafetySettingsFromMap(map[string]string{
+		"hate":                          "block_low",
+		" Harassment ":                  "BLOCK_NONE",
+		"HARM_CATEGORY_CIVIC_INTEGRITY": "off",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []SafetySetting{
+		{Category: HarmCategoryHarassment, Threshold: HarmBlockNone},
+		{Category: HarmCategoryHateSpeech, Threshold: HarmBlockLowAndAbove},
+		{Category: HarmCategoryCivicIntegrity, Threshold: HarmBlockOff},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	for name, m := range map[string]map[string]string{
+		"unknown category":  {"violence": "block_none"},
+		"unknown threshold": {"hate": "block_some"},
+		"empty threshold":   {"hate": ""},
+		"duplicate":         {"hate": "block_low", "hate_speech": "block_none"},
+	} {
+		if _, err := SafetySettingsFromMap(m); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package gemini
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strings"
+
+	chassiserrors "github.com/ai8future/chassis-go/v11/errors"
+)
+
+var textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+
+// SchemaFromType builds a Schema describing how encoding/json marshals a T,
+// so a response decoded with Response.JSON or GenerateJSON fits it. Struct
+// fields are named by their json tags, skipped with "-", and required unless
+// tagged omitempty; the description tag sets a property's Description.
+// Properties are ordered as declared and embedded structs are flattened.
+// Strings, booleans, integers, floats, slices, arrays, pointers, nested
+// structs, and types implementing encoding.TextMarshaler (as STRING, e.g.
+// time.Time) are supported. Maps, interfaces, channels, funcs, and recursive
+// types are not and yield a validation error.
+func SchemaFromType[T any]() (*Schema, error) {
+	t := reflect.TypeFor[T]()
+	return schemaFor(t, t.String(), nil)
+}
+
+// WithResponseSchemaFromStruct is WithResponseSchema with the schema built by
+// SchemaFromType[T]. An unsupported T fails the call with the build error.
+func WithResponseSchemaFromStruct[T any]() GenerateOption {
+	schema, err := SchemaFromType[T]()
+	return func(g *generateConfig) {
+		if err != nil {
+			g.fail(err)
+			return
+		}
+		WithResponseSchema(schema)(g)
+	}
+}
+
+// schemaFor returns the schema for t, found at path for error messages.
+// visiting holds the struct types on the current path, to reject recursive
+// types the schema cannot express.
+func schemaFor(t reflect.Type, path string, visiting []reflect.Type) (*Schema, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType) {
+		return &Schema{Type: "STRING"}, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "STRING"}, nil
+	case reflect.Bool:
+		return &Schema{Type: "BOOLEAN"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "INTEGER"}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "NUMBER"}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "STRING"}, nil // []byte marshals as base64
+		}
+		items, err := schemaFor(t.Elem(), path+"[]", visiting)
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "ARRAY", Items: items}, nil
+	case reflect.Struct:
+		if err := checkRecursion(t, path, visiting); err != nil {
+			return nil, err
+		}
+		s := &Schema{Type: "OBJECT", Properties: make(map[string]*Schema)}
+		if err := addFields(s, t, path, append(visiting, t)); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: cannot build schema for %s type %s at %s", t.Kind(), t, path))
+}
+
+// checkRecursion rejects struct type t if it is already on the current path.
+func checkRecursion(t reflect.Type, path string, visiting []reflect.Type) error {
+	for _, v := range visiting {
+		if v == t {
+			return chassiserrors.ValidationError(fmt.Sprintf("gemini: cannot build schema for recursive type %s at %s", t, path))
+		}
+	}
+	return nil
+}
+
+// addFields adds the json-visible fields of struct type t to s, flattening
+// untagged embedded structs.
+func addFields(s *Schema, t reflect.Type, path string, visiting []reflect.Type) error {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			if err := checkRecursion(ft, path, visiting); err != nil {
+				return err
+			}
+			if err := addFields(s, ft, path, append(visiting, ft)); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		prop, err := schemaFor(f.Type, path+"."+f.Name, visiting)
+		if err != nil {
+			return err
+		}
+		prop.Description = f.Tag.Get("description")
+		s.Properties[name] = prop
+		s.PropertyOrdering = append(s.PropertyOrdering, name)
+		if !strings.Contains(","+opts+",", ",omitempty,") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type schemaAddress struct {
+	City string `json:"city" description:"City name"`
+	Zip  string `json:"zip,omitempty"`
+}
+
+type schemaAudit struct {
+	Updated time.Time `json:"updated"`
+}
+
+type schemaPerson struct {
+	schemaAudit
+	Name      string          `json:"name" description:"Full name"`
+	Age       int             `json:"age"`
+	Score     float64         `json:"score,omitempty"`
+	Active    bool            `json:"active"`
+	Tags      []string        `json:"tags"`
+	Home      *schemaAddress  `json:"home" description:"Primary address"`
+	Past      []schemaAddress `json:"past,omitempty"`
+	Secret    string          `json:"-"`
+	NoTag     uint8
+	unexposed int
+}
+
+func TestSchemaFromType_NestedStruct(t *testing.T) {
+	got, err := SchemaFromType[schemaPerson]()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	address := func(desc string) *Schema {
+		return &Schema{
+			Type:        "OBJECT",
+			Description: desc,
+			Properties: map[string]*Schema{
+				"city": {Type: "STRING", Description: "City name"},
+				"zip":  {Type: "STRING"},
+			},
+			Required:         []string{"city"},
+			PropertyOrdering: []string{"city", "zip"},
+		}
+	}
+	want := &Schema{
+		Type: "OBJECT",
+		Properties: map[string]*Schema{
+			"updated": {Type: "STRING"},
+			"name":    {Type: "STRING", Description: "Full name"},
+			"age":     {Type: "INTEGER"},
+			"score":   {Type: "NUMBER"},
+			"active":  {Type: "BOOLEAN"},
+			"tags":    {Type: "ARRAY", Items: &Schema{Type: "STRING"}},
+			"home":    address("Primary address"),
+			"past":    {Type: "ARRAY", Items: address("")},
+			"NoTag":   {Type: "INTEGER"},
+		},
+		Required:         []string{"updated", "name", "age", "active", "tags", "home", "NoTag"},
+		PropertyOrdering: []string{"updated", "name", "age", "score", "active", "tags", "home", "past", "NoTag"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.MarshalIndent(got, "", "  ")
+		wantJSON, _ := json.MarshalIndent(want, "", "  ")
+		t.Errorf("schema mismatch:\ngot  %s\nwant %s", gotJSON, wantJSON)
+	}
+}
+
+type schemaNode struct {
+	Children []schemaNode `json:"children"`
+}
+
+type schemaEmbedsSelf struct {
+	Name string `json:"name"`
+	*schemaEmbedsSelf
+}
+
+type schemaWithMap struct {
+	Counts map[string]int `json:"counts"`
+}
+
+func TestSchemaFromType_Unsupported(t *testing.T) {
+	if _, err := SchemaFromType[schemaNode](); err == nil || !strings.Contains(err.Error(), "recursive") {
+		t.Errorf("recursive type: got %v", err)
+	}
+	if _, err := SchemaFromType[schemaEmbedsSelf](); err == nil || !strings.Contains(err.Error(), "recursive") {
+		t.Errorf("recursive embedded type: got %v", err)
+	}
+	if _, err := SchemaFromType[schemaWithMap](); err == nil || !strings.Contains(err.Error(), "schemaWithMap.Counts") {
+		t.Errorf("map field: got %v", err)
+	}
+}
+
+func TestWithResponseSchemaFromStruct(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	if _, err := c.Generate(context.Background(), "test", WithResponseSchemaFromStruct[schemaAddress]()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{`"responseMimeType":"application/json"`, `"required":["city"]`, `"description":"City name"`} {
+		if !strings.Contains(string(mock.body), want) {
+			t.Errorf("missing %s in %s", want, mock.body)
+		}
+	}
+
+	mock.body = nil
+	_, err := c.Generate(context.Background(), "test", WithResponseSchemaFromStruct[schemaWithMap]())
+	if err == nil || mock.body != nil {
+		t.Errorf("unsupported type should fail before sending: %v", err)
+	}
+}
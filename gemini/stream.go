@@ -0,0 +1,246 @@
+package gemini
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	chassiserrors "github.com/ai8future/chassis-go/v11/errors"
+)
+
+// GenerateStreamCallback streams a response from the streamGenerateContent
+// endpoint, invoking onChunk with each text delta as it arrives. It returns the
+// complete response accumulated from all chunks, with UsageMetadata taken from
+// the final chunk that reports it. onChunk may be nil. If ctx is canceled or
+// times out mid-stream, the error is a *ResponseError wrapping ctx.Err()
+// whose Response holds what arrived so far, as distinct from a network error.
+func (c *Client) GenerateStreamCallback(ctx context.Context, prompt string, onChunk func(text string), opts ...GenerateOption) (*Response, error) {
+	cfg, err := c.newGenerateConfig(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	c = c.forModel(cfg.model)
+	reqBody := c.buildRequest(c.userTurn(prompt), cfg)
+	if err := c.checkTokenGuard(ctx, reqBody, cfg); err != nil {
+		return nil, err
+	}
+	var check *jsonStreamChecker
+	if cfg.jsonCheck != nil && cfg.mimeType == "application/json" {
+		check = &jsonStreamChecker{schema: cfg.schema, onInvalid: cfg.jsonCheck}
+	}
+	resp, err := c.stream(ctx, reqBody, cfg, func(chunk *Response) {
+		text := chunk.Text()
+		if text != "" && check != nil {
+			check.add(text)
+		}
+		if text != "" && onChunk != nil {
+			onChunk(text)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.Model = c.model
+	if err := checkFinishReason(resp, cfg); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// stream performs a streaming request, calling onChunk for every parsed SSE
+// event, and returns the aggregated response. If ctx ends mid-stream, the
+// error is a *ResponseError wrapping ctx.Err() that holds the partial response.
+func (c *Client) stream(ctx context.Context, reqBody *Request, cfg *generateConfig, onChunk func(*Response)) (*Response, error) {
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("gemini: marshal request: %w", err)
+	}
+
+	endpoint := c.endpoint("streamGenerateContent", url.Values{"alt": {"sse"}})
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := c.newRequest(ctx, endpoint, jsonData, cfg.requestID)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.doer.Do(req)
+	if err != nil {
+		return nil, chassiserrors.DependencyError(fmt.Sprintf("gemini: do request: %v", err)).WithCause(err)
+	}
+	// Closed even if onChunk panics.
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes+1))
+		return nil, c.modelNotFound(httpError(resp.StatusCode, body))
+	}
+
+	// The idle timer aborts the read of a stalled, possibly half-open,
+	// connection; it is reset whenever a line arrives, keepalives included.
+	var idled atomic.Bool
+	var idle *time.Timer
+	if cfg.streamIdle > 0 {
+		idle = time.AfterFunc(cfg.streamIdle, func() {
+			idled.Store(true)
+			cancel()
+			resp.Body.Close()
+		})
+		defer idle.Stop()
+	}
+
+	agg := Response{ResponseID: resp.Header.Get(responseIDHeader)}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxResponseBytes)
+	for scanner.Scan() {
+		if idle != nil {
+			idle.Reset(cfg.streamIdle)
+		}
+		line := scanner.Text()
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue // blank separators, comments, and other SSE fields
+		}
+		if cfg.rawSink != nil {
+			_, _ = io.WriteString(cfg.rawSink, line+"\n")
+		}
+		var chunk Response
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &chunk); err != nil {
+			return nil, fmt.Errorf("gemini: unmarshal stream chunk: %w", err)
+		}
+		mergeChunk(&agg, &chunk)
+		onChunk(&chunk)
+	}
+	if err := scanner.Err(); err != nil {
+		if idled.Load() {
+			return nil, fmt.Errorf("%w: no data for %v", ErrStreamIdle, cfg.streamIdle)
+		}
+		if ctxErr := parent.Err(); ctxErr != nil {
+			return nil, &ResponseError{Err: fmt.Errorf("gemini: stream interrupted: %w", ctxErr), Response: &agg}
+		}
+		return nil, chassiserrors.DependencyError(fmt.Sprintf("gemini: read stream: %v", err)).WithCause(err)
+	}
+	c.recordUsage(&agg)
+	return &agg, nil
+}
+
+// mergeFunctionCall folds a streamed call fragment into dst, applying its
+// partial arguments to dst.Args.
+func mergeFunctionCall(dst, src *FunctionCall) {
+	if src.Name != "" {
+		dst.Name = src.Name
+	}
+	for k, v := range src.Args {
+		if dst.Args == nil {
+			dst.Args = make(map[string]any)
+		}
+		dst.Args[k] = v
+	}
+	for _, pa := range src.PartialArgs {
+		dst.applyPartialArg(pa)
+	}
+	dst.WillContinue = src.WillContinue
+	if !dst.WillContinue {
+		dst.continuing = nil
+	}
+}
+
+// applyPartialArg sets the value addressed by pa.JSONPath in c.Args,
+// appending to a string value that an earlier fragment left open. Only
+// object keys are addressable; fragments with other paths are dropped.
+func (c *FunctionCall) applyPartialArg(pa PartialArg) {
+	path, ok := strings.CutPrefix(pa.JSONPath, "$.")
+	if !ok || path == "" {
+		return
+	}
+	keys := strings.Split(path, ".")
+	if c.Args == nil {
+		c.Args = make(map[string]any)
+	}
+	obj := c.Args
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := obj[k].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			obj[k] = next
+		}
+		obj = next
+	}
+	last := keys[len(keys)-1]
+
+	switch {
+	case pa.StringValue != nil:
+		s := *pa.StringValue
+		if prev, ok := obj[last].(string); ok && c.continuing[pa.JSONPath] {
+			s = prev + s
+		}
+		obj[last] = s
+	case pa.NumberValue != nil:
+		obj[last] = *pa.NumberValue
+	case pa.BoolValue != nil:
+		obj[last] = *pa.BoolValue
+	case pa.NullValue != nil:
+		obj[last] = nil
+	}
+	if c.continuing == nil {
+		c.continuing = make(map[string]bool)
+	}
+	c.continuing[pa.JSONPath] = pa.WillContinue
+}
+
+// mergeChunk folds a streamed chunk into the aggregate response. Candidates
+// are matched by position; consecutive text parts are concatenated unless
+// only one is a thought, a function call marked WillContinue absorbs the next
+// chunk's call fragment, and citation sources accumulate.
+func mergeChunk(agg, chunk *Response) {
+	for i, cand := range chunk.Candidates {
+		if i >= len(agg.Candidates) {
+			agg.Candidates = append(agg.Candidates, Candidate{})
+		}
+		dst := &agg.Candidates[i]
+		if cand.Content.Role != "" {
+			dst.Content.Role = cand.Content.Role
+		}
+		for _, p := range cand.Content.Parts {
+			parts := dst.Content.Parts
+			n := len(parts)
+			if n > 0 && parts[n-1].Kind() == PartKindText && p.Kind() == PartKindText && parts[n-1].Thought == p.Thought {
+				parts[n-1].Text += p.Text
+				continue
+			}
+			if p.FunctionCall != nil {
+				if n > 0 && parts[n-1].FunctionCall != nil && parts[n-1].FunctionCall.WillContinue {
+					mergeFunctionCall(parts[n-1].FunctionCall, p.FunctionCall)
+					continue
+				}
+				fc := &FunctionCall{}
+				mergeFunctionCall(fc, p.FunctionCall)
+				p.FunctionCall = fc
+			}
+			dst.Content.Parts = append(parts, p)
+		}
+		if cand.FinishReason != "" {
+			dst.FinishReason = cand.FinishReason
+		}
+		if len(cand.SafetyRatings) > 0 {
+			dst.SafetyRatings = cand.SafetyRatings
+		}
+		if cm := cand.CitationMetadata; cm != nil {
+			if dst.CitationMetadata == nil {
+				dst.CitationMetadata = &CitationMetadata{}
+			}
+			dst.CitationMetadata.CitationSources = append(dst.CitationMetadata.CitationSources, cm.CitationSources...)
+		}
+	}
+	if chunk.UsageMetadata != (UsageMetadata{}) {
+		agg.UsageMetadata = chunk.UsageMetadata
+	}
+}
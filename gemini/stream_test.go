@@ -0,0 +1,392 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// trackingBody records whether it was closed.
+type trackingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+// streamDoer replies with an SSE body built from the given data payloads.
+type streamDoer struct {
+	req        *http.Request
+	statusCode int
+	events     []string
+	header     http.Header
+	body       *trackingBody
+}
+
+func (s *streamDoer) Do(req *http.Request) (*http.Response, error) {
+	s.req = req
+	var b strings.Builder
+	for _, e := range s.events {
+		b.WriteString("data: " + e + "\r\n\r\n")
+	}
+	s.body = &trackingBody{Reader: strings.NewReader(b.String())}
+	code := s.statusCode
+	if code == 0 {
+		code = http.StatusOK
+	}
+	return &http.Response{StatusCode: code, Header: s.header, Body: s.body}, nil
+}
+
+var helloStream = []string{
+	`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}],"usageMetadata":{"promptTokenCount":3}}`,
+	`{"candidates":[{"content":{"role":"model","parts":[{"text":"lo, "}]}}]}`,
+	`{"candidates":[{"content":{"role":"model","parts":[{"text":"world!"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":4,"totalTokenCount":7}}`,
+}
+
+func TestGenerateStreamCallback(t *testing.T) {
+	doer := &streamDoer{events: helloStream}
+	c := mustNew(t, "key", WithDoer(doer), WithBaseURL("https://api.test"), WithModel("m"))
+
+	var deltas []string
+	resp, err := c.GenerateStreamCallback(context.Background(), "hi", func(text string) {
+		deltas = append(deltas, text)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := "https://api.test/m:streamGenerateContent?alt=sse"; doer.req.URL.String() != want {
+		t.Errorf("URL: got %q, want %q", doer.req.URL.String(), want)
+	}
+	if strings.Join(deltas, "|") != "Hel|lo, |world!" {
+		t.Errorf("deltas: got %q", deltas)
+	}
+	if got := resp.Text(); got != "Hello, world!" {
+		t.Errorf("Text(): got %q", got)
+	}
+	if n := len(resp.Candidates[0].Content.Parts); n != 1 {
+		t.Errorf("text deltas should merge into one part, got %d", n)
+	}
+	if resp.Candidates[0].FinishReason != "STOP" {
+		t.Errorf("FinishReason: got %q", resp.Candidates[0].FinishReason)
+	}
+	if resp.UsageMetadata.TotalTokenCount != 7 || resp.UsageMetadata.CandidatesTokenCount != 4 {
+		t.Errorf("UsageMetadata: got %+v", resp.UsageMetadata)
+	}
+	if !doer.body.closed {
+		t.Error("response body should be closed")
+	}
+}
+
+func TestGenerateStreamCallback_NilCallback(t *testing.T) {
+	doer := &streamDoer{events: helloStream}
+	c := mustNew(t, "key", WithDoer(doer))
+
+	resp, err := c.GenerateStreamCallback(context.Background(), "hi", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Text() != "Hello, world!" {
+		t.Errorf("Text(): got %q", resp.Text())
+	}
+}
+
+func TestGenerateStreamCallback_PanicClosesBody(t *testing.T) {
+	doer := &streamDoer{events: helloStream}
+	c := mustNew(t, "key", WithDoer(doer))
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("expected callback panic to propagate")
+			}
+		}()
+		_, _ = c.GenerateStreamCallback(context.Background(), "hi", func(string) { panic("boom") })
+	}()
+
+	if !doer.body.closed {
+		t.Error("response body leaked after callback panic")
+	}
+}
+
+func TestGenerateStreamCallback_RawSink(t *testing.T) {
+	doer := &streamDoer{events: helloStream}
+	c := mustNew(t, "key", WithDoer(doer))
+
+	var sink strings.Builder
+	resp, err := c.GenerateStreamCallback(context.Background(), "hi", nil, WithStreamRawSink(&sink))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var want strings.Builder
+	for _, e := range helloStream {
+		want.WriteString("data: " + e + "\n")
+	}
+	if sink.String() != want.String() {
+		t.Errorf("sink: got %q, want %q", sink.String(), want.String())
+	}
+	if resp.Text() != "Hello, world!" {
+		t.Errorf("Text(): got %q", resp.Text())
+	}
+}
+
+func TestGenerateStreamCallback_HTTPError(t *testing.T) {
+	doer := &streamDoer{statusCode: 500, events: []string{`{"error":"boom"}`}}
+	c := mustNew(t, "key", WithDoer(doer))
+
+	_, err := c.GenerateStreamCallback(context.Background(), "hi", nil)
+	if err == nil || !strings.Contains(err.Error(), "HTTP 500") {
+		t.Fatalf("expected HTTP 500 error, got %v", err)
+	}
+	if !doer.body.closed {
+		t.Error("response body should be closed on error")
+	}
+}
+
+func TestGenerateStreamCallback_MalformedChunk(t *testing.T) {
+	doer := &streamDoer{events: []string{`{"candidates":`}}
+	c := mustNew(t, "key", WithDoer(doer))
+
+	_, err := c.GenerateStreamCallback(context.Background(), "hi", nil)
+	if err == nil || !strings.Contains(err.Error(), "unmarshal stream chunk") {
+		t.Fatalf("expected unmarshal error, got %v", err)
+	}
+}
+
+func TestGenerateStreamCallback_ValidatesOptions(t *testing.T) {
+	doer := &streamDoer{events: helloStream}
+	c := mustNew(t, "key", WithDoer(doer))
+
+	if _, err := c.GenerateStreamCallback(context.Background(), "hi", nil, WithMaxTokens(0)); err == nil {
+		t.Fatal("expected validation error")
+	}
+	if doer.req != nil {
+		t.Error("request should not be sent when validation fails")
+	}
+}
+
+func TestMergeChunk_KeepsNonTextPartsSeparate(t *testing.T) {
+	var agg Response
+	mergeChunk(&agg, &Response{Candidates: []Candidate{{Content: ResponseContent{Parts: []ResponsePart{{Text: "a"}}}}}})
+	mergeChunk(&agg, &Response{Candidates: []Candidate{{Content: ResponseContent{Parts: []ResponsePart{{FunctionCall: &FunctionCall{Name: "f"}}}}}}})
+	mergeChunk(&agg, &Response{Candidates: []Candidate{{Content: ResponseContent{Parts: []ResponsePart{{Text: "b"}}}}}})
+
+	parts := agg.Parts()
+	if len(parts) != 3 || parts[0].Text != "a" || parts[1].FunctionCall == nil || parts[2].Text != "b" {
+		t.Errorf("unexpected parts: %+v", parts)
+	}
+}
+
+func TestMergeChunk_KeepsThoughtsSeparate(t *testing.T) {
+	var agg Response
+	for _, p := range []ResponsePart{{Text: "hmm, ", Thought: true}, {Text: "yes", Thought: true}, {Text: "Answer"}, {Text: "!"}} {
+		mergeChunk(&agg, &Response{Candidates: []Candidate{{Content: ResponseContent{Parts: []ResponsePart{p}}}}})
+	}
+	if parts := agg.Parts(); len(parts) != 2 {
+		t.Fatalf("parts: got %+v", parts)
+	}
+	if agg.Thoughts() != "hmm, yes" || agg.Text() != "Answer!" {
+		t.Errorf("Thoughts %q, Text %q", agg.Thoughts(), agg.Text())
+	}
+}
+
+func TestMergeChunk_AccumulatesCitations(t *testing.T) {
+	var agg Response
+	cite := func(uri string) *CitationMetadata {
+		return &CitationMetadata{CitationSources: []CitationSource{{URI: uri}}}
+	}
+	mergeChunk(&agg, &Response{Candidates: []Candidate{{CitationMetadata: cite("a")}}})
+	mergeChunk(&agg, &Response{Candidates: []Candidate{{}}})
+	mergeChunk(&agg, &Response{Candidates: []Candidate{{CitationMetadata: cite("b")}}})
+
+	if got := agg.CitationSources(); len(got) != 2 || got[0].URI != "a" || got[1].URI != "b" {
+		t.Errorf("citations: got %+v", got)
+	}
+}
+
+func TestGenerateStreamCallback_RequestID(t *testing.T) {
+	doer := &streamDoer{events: helloStream, header: http.Header{"X-Goog-Request-Id": {"srv-7"}}}
+	c := mustNew(t, "key", WithDoer(doer))
+
+	resp, err := c.GenerateStreamCallback(context.Background(), "hi", nil, WithRequestID("trace-7"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := doer.req.Header.Get("x-request-id"); got != "trace-7" {
+		t.Errorf("x-request-id: got %q", got)
+	}
+	if resp.ResponseID != "srv-7" {
+		t.Errorf("ResponseID: got %q, want %q", resp.ResponseID, "srv-7")
+	}
+}
+
+// stallingBody yields data and then blocks, like a half-open connection,
+// until it is closed.
+type stallingBody struct {
+	data   *strings.Reader
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (b *stallingBody) Read(p []byte) (int, error) {
+	if b.data.Len() > 0 {
+		return b.data.Read(p)
+	}
+	<-b.closed
+	return 0, errors.New("read on closed body")
+}
+
+func (b *stallingBody) Close() error {
+	b.once.Do(func() { close(b.closed) })
+	return nil
+}
+
+type stallingDoer struct{ body *stallingBody }
+
+func (d *stallingDoer) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: d.body}, nil
+}
+
+func TestGenerateStreamCallback_IdleTimeout(t *testing.T) {
+	body := &stallingBody{
+		data:   strings.NewReader("data: " + helloStream[0] + "\r\n\r\n"),
+		closed: make(chan struct{}),
+	}
+	c := mustNew(t, "key", WithDoer(&stallingDoer{body: body}))
+
+	var got []string
+	start := time.Now()
+	_, err := c.GenerateStreamCallback(context.Background(), "hi", func(text string) {
+		got = append(got, text)
+	}, WithStreamIdleTimeout(50*time.Millisecond))
+	if !errors.Is(err, ErrStreamIdle) {
+		t.Fatalf("expected ErrStreamIdle, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("idle timeout should abort the stalled read promptly")
+	}
+	if len(got) != 1 || got[0] != "Hel" {
+		t.Errorf("chunks before stall: got %q", got)
+	}
+}
+
+func TestGenerateStreamCallback_IdleTimeoutKeepalive(t *testing.T) {
+	pr, pw := io.Pipe()
+	go func() {
+		io.WriteString(pw, "data: "+helloStream[0]+"\r\n\r\n")
+		// A gap of 200ms between chunks, kept alive by SSE comments.
+		for range 10 {
+			time.Sleep(20 * time.Millisecond)
+			if _, err := io.WriteString(pw, ": ping\r\n\r\n"); err != nil {
+				return
+			}
+		}
+		for _, e := range helloStream[1:] {
+			io.WriteString(pw, "data: "+e+"\r\n\r\n")
+		}
+		pw.Close()
+	}()
+	doer := DoerFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: pr}, nil
+	})
+	c := mustNew(t, "key", WithDoer(doer))
+
+	resp, err := c.GenerateStreamCallback(context.Background(), "hi", nil, WithStreamIdleTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("keepalives should hold the stream open, got %v", err)
+	}
+	if resp.Text() != "Hello, world!" {
+		t.Errorf("Text(): got %q", resp.Text())
+	}
+}
+
+func TestGenerateStreamCallback_CanceledMidStream(t *testing.T) {
+	body := &stallingBody{
+		data:   strings.NewReader("data: " + helloStream[0] + "\r\n\r\n"),
+		closed: make(chan struct{}),
+	}
+	// Like net/http, abort the body read once the request context ends.
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		context.AfterFunc(req.Context(), func() { body.Close() })
+		return &http.Response{StatusCode: http.StatusOK, Body: body}, nil
+	})
+	c := mustNew(t, "key", WithDoer(doer))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := c.GenerateStreamCallback(ctx, "hi", func(string) { cancel() })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	var re *ResponseError
+	if !errors.As(err, &re) || re.Response.Text() != "Hel" {
+		t.Fatalf("expected *ResponseError holding the partial text, got %v", err)
+	}
+	if re.Response.UsageMetadata.PromptTokenCount != 3 {
+		t.Errorf("partial usage: got %+v", re.Response.UsageMetadata)
+	}
+}
+
+func TestGenerateStreamCallback_IdleTimeoutNotTripped(t *testing.T) {
+	doer := &streamDoer{events: helloStream}
+	c := mustNew(t, "key", WithDoer(doer))
+
+	resp, err := c.GenerateStreamCallback(context.Background(), "hi", nil, WithStreamIdleTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Text() != "Hello, world!" {
+		t.Errorf("Text(): got %q", resp.Text())
+	}
+}
+
+func TestGenerateStreamCallback_SplitFunctionCall(t *testing.T) {
+	doer := &streamDoer{events: []string{
+		`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","willContinue":true,"partialArgs":[{"jsonPath":"$.location","stringValue":"San ","willContinue":true}]}}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"willContinue":true,"partialArgs":[{"jsonPath":"$.location","stringValue":"Francisco"},{"jsonPath":"$.options.days","numberValue":3}]}}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"partialArgs":[{"jsonPath":"$.options.metric","boolValue":true}]}}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_time","args":{"tz":"PST"}}}]},"finishReason":"STOP"}]}`,
+	}}
+	c := mustNew(t, "key", WithDoer(doer))
+
+	resp, err := c.GenerateStreamCallback(context.Background(), "weather?", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	calls := resp.FunctionCalls()
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 reassembled calls, got %d: %+v", len(calls), calls)
+	}
+	weather := calls[0]
+	if weather.Name != "get_weather" || weather.WillContinue || len(weather.PartialArgs) != 0 {
+		t.Errorf("first call not finalized: %+v", weather)
+	}
+	if weather.Args["location"] != "San Francisco" {
+		t.Errorf("location: got %v", weather.Args["location"])
+	}
+	opts, _ := weather.Args["options"].(map[string]any)
+	if opts["days"] != 3.0 || opts["metric"] != true {
+		t.Errorf("options: got %v", weather.Args["options"])
+	}
+	if calls[1].Name != "get_time" || calls[1].Args["tz"] != "PST" {
+		t.Errorf("second call: got %+v", calls[1])
+	}
+}
+
+func TestMergeChunk_StringFragmentsRestartWithoutContinue(t *testing.T) {
+	str := func(s string) *string { return &s }
+	fc := &FunctionCall{}
+	mergeFunctionCall(fc, &FunctionCall{Name: "f", WillContinue: true, PartialArgs: []PartialArg{{JSONPath: "$.q", StringValue: str("a")}}})
+	mergeFunctionCall(fc, &FunctionCall{PartialArgs: []PartialArg{{JSONPath: "$.q", StringValue: str("b")}}})
+	if fc.Args["q"] != "b" {
+		t.Errorf("a completed string should be replaced, not appended: got %v", fc.Args["q"])
+	}
+}
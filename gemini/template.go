@@ -0,0 +1,44 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	chassiserrors "github.com/ai8future/chassis-go/v11/errors"
+)
+
+// Template is a prompt with named placeholders, using text/template syntax
+// such as "Summarize {{.doc}} in {{.lang}}". It is safe for concurrent use.
+type Template struct {
+	tmpl *template.Template
+}
+
+// NewTemplate parses text as a prompt template.
+func NewTemplate(text string) (*Template, error) {
+	t, err := template.New("prompt").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: parse template: %v", err))
+	}
+	return &Template{tmpl: t}, nil
+}
+
+// Render fills the template's placeholders from vars. A placeholder with no
+// matching variable is an error rather than rendering "<no value>".
+func (t *Template) Render(vars map[string]string) (string, error) {
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, vars); err != nil {
+		return "", chassiserrors.ValidationError(fmt.Sprintf("gemini: render template: %v", err))
+	}
+	return b.String(), nil
+}
+
+// GenerateTemplate renders tmpl with vars and sends the result as the prompt.
+func (c *Client) GenerateTemplate(ctx context.Context, tmpl *Template, vars map[string]string, opts ...GenerateOption) (*Response, error) {
+	prompt, err := tmpl.Render(vars)
+	if err != nil {
+		return nil, err
+	}
+	return c.Generate(ctx, prompt, opts...)
+}
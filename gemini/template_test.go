@@ -0,0 +1,76 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTemplateRender(t *testing.T) {
+	tmpl, err := NewTemplate("Summarize {{.doc}} in {{.lang}}.")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := tmpl.Render(map[string]string{"doc": "the report", "lang": "French"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "Summarize the report in French."; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTemplateRender_MissingVariable(t *testing.T) {
+	tmpl, err := NewTemplate("Hello {{.name}}, from {{.sender}}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := tmpl.Render(map[string]string{"name": "Ada"})
+	if err == nil {
+		t.Fatalf("expected missing variable error, got %q", got)
+	}
+	if !strings.Contains(err.Error(), "sender") {
+		t.Errorf("error should name the missing variable, got %v", err)
+	}
+	if _, err := tmpl.Render(nil); err == nil {
+		t.Error("expected error rendering with nil vars")
+	}
+}
+
+func TestNewTemplate_ParseError(t *testing.T) {
+	if _, err := NewTemplate("Hello {{.name"); err == nil || !strings.Contains(err.Error(), "parse template") {
+		t.Fatalf("expected parse error, got %v", err)
+	}
+}
+
+func TestGenerateTemplate(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: okBody}
+	c := mustNew(t, "key", WithDoer(mock))
+	tmpl, err := NewTemplate("Translate {{.text}}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := c.GenerateTemplate(context.Background(), tmpl, map[string]string{"text": "hola"}, WithMaxTokens(10)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var req Request
+	if err := json.Unmarshal(mock.body, &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got := req.Contents[0].Parts[0].Text; got != "Translate hola" {
+		t.Errorf("prompt: got %q", got)
+	}
+	if req.GenerationConfig.MaxOutputTokens != 10 {
+		t.Errorf("options not applied: %+v", req.GenerationConfig)
+	}
+
+	mock.req = nil
+	if _, err := c.GenerateTemplate(context.Background(), tmpl, nil); err == nil {
+		t.Error("expected render error")
+	}
+	if mock.req != nil {
+		t.Error("request should not be sent when rendering fails")
+	}
+}
@@ -0,0 +1,53 @@
+package gemini
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// timeoutDoer bounds each request with a context deadline, for Doers that
+// have no timeout of their own. The deadline covers reading the body and is
+// released when the body is closed.
+type timeoutDoer struct {
+	next    Doer
+	timeout time.Duration
+}
+
+func (t *timeoutDoer) Do(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.next.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody cancels the request context once the body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// attemptTimeoutKey carries the WithCallTimeout per-attempt deadline.
+type attemptTimeoutKey struct{}
+
+func withAttemptTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, attemptTimeoutKey{}, d)
+}
+
+// attemptTimeout returns the per-attempt deadline set by WithCallTimeout, or
+// zero.
+func attemptTimeout(ctx context.Context) time.Duration {
+	d, _ := ctx.Value(attemptTimeoutKey{}).(time.Duration)
+	return d
+}
@@ -0,0 +1,242 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	chassiserrors "github.com/ai8future/chassis-go/v11/errors"
+)
+
+// charsPerToken approximates the average token length of English text.
+const charsPerToken = 4
+
+// EstimateTokens returns a rough, local token count for text. It makes no API
+// call and is intended for pre-flight checks, not billing.
+func EstimateTokens(text string) int {
+	n := utf8.RuneCountInString(text)
+	return (n + charsPerToken - 1) / charsPerToken
+}
+
+// FitsContext reports whether the estimated prompt tokens plus the requested
+// max output tokens fit within the model's input token limit. The limit must
+// be seeded with WithModelInfo; no API call is made. With WithUnlimitedTokens
+// the model's output token limit, if known, is counted instead.
+func (c *Client) FitsContext(prompt string, opts ...GenerateOption) (bool, error) {
+	cfg, err := c.newGenerateConfig(context.Background(), opts)
+	if err != nil {
+		return false, err
+	}
+	c = c.forModel(cfg.model)
+	limit := c.modelInfo.InputTokenLimit
+	if limit <= 0 {
+		return false, chassiserrors.ValidationError(fmt.Sprintf("gemini: no input token limit known for model %q; seed it with WithModelInfo", c.model))
+	}
+	out := cfg.maxTokens
+	if cfg.unlimitedTokens {
+		out = c.modelInfo.OutputTokenLimit
+	}
+	return EstimateTokens(prompt)+out <= limit, nil
+}
+
+// CountTokens asks the API how many tokens the request for prompt and opts
+// would consume as input, including system instructions and tools.
+func (c *Client) CountTokens(ctx context.Context, prompt string, opts ...GenerateOption) (int, error) {
+	cfg, err := c.newGenerateConfig(ctx, opts)
+	if err != nil {
+		return 0, err
+	}
+	return c.forModel(cfg.model).countTokens(ctx, c.buildRequest(c.userTurn(prompt), cfg), cfg.requestID)
+}
+
+// countTokens calls the countTokens method for a built request, consulting
+// the token count cache when WithCache is set.
+func (c *Client) countTokens(ctx context.Context, reqBody *Request, requestID string) (int, error) {
+	model := c.model
+	if !strings.Contains(model, "/") {
+		model = "models/" + model
+	}
+	body := countTokensRequest{GenerateContentRequest: countTokensGenerateRequest{Model: model, Request: reqBody}}
+	var key string
+	if c.countCache != nil {
+		var err error
+		if key, err = cacheKey(c.endpoint("countTokens", nil), body); err != nil {
+			return 0, fmt.Errorf("gemini: marshal request: %w", err)
+		}
+		if n, ok := c.countCache.getTokens(key, c.clock.Now()); ok {
+			return n, nil
+		}
+	}
+	var resp countTokensResponse
+	if err := c.doRequest(ctx, "countTokens", nil, body, &resp, requestID); err != nil {
+		return 0, err
+	}
+	if c.countCache != nil {
+		c.countCache.putTokens(key, resp.TotalTokens, c.clock.Now())
+	}
+	return resp.TotalTokens, nil
+}
+
+// checkTokenGuard enforces WithTokenGuard before a generation call.
+func (c *Client) checkTokenGuard(ctx context.Context, reqBody *Request, cfg *generateConfig) error {
+	if cfg.tokenGuard == 0 {
+		return nil
+	}
+	n, err := c.countTokens(ctx, reqBody, cfg.requestID)
+	if err != nil {
+		return err
+	}
+	if n > cfg.tokenGuard {
+		return fmt.Errorf("%w: %d tokens exceeds limit of %d", ErrPromptTooLarge, n, cfg.tokenGuard)
+	}
+	return nil
+}
+
+// Boundaries SplitByTokens prefers, coarsest first. Each match ends a segment
+// and stays attached to the text before it.
+var (
+	paragraphBreak = regexp.MustCompile(`\n[ \t]*\n\s*`)
+	sentenceBreak  = regexp.MustCompile(`[.!?]+["')\]]*\s+`)
+	wordBreak      = regexp.MustCompile(`\s+`)
+)
+
+// SplitByTokens splits text into chunks of at most maxTokens tokens each, as
+// counted by the countTokens API for the chunk alone: the client's system
+// instruction, prompt preprocessor, and tools are not included. It packs
+// chunks greedily on paragraph boundaries, falling back to sentences, then
+// words, then arbitrary character positions for segments that do not fit on
+// their own. Concatenating the chunks yields text unchanged. A local estimate,
+// scaled by the counts seen so far, picks how many segments to try at once,
+// so most chunks cost a few countTokens calls rather than one per segment.
+func (c *Client) SplitByTokens(ctx context.Context, text string, maxTokens int) ([]string, error) {
+	if maxTokens < 1 {
+		return nil, chassiserrors.ValidationError(fmt.Sprintf("gemini: split maxTokens must be at least 1, got %d", maxTokens))
+	}
+	if text == "" {
+		return nil, nil
+	}
+	s := &tokenSplitter{ctx: ctx, c: c, max: maxTokens, scale: 1}
+	if err := s.split(text, 0); err != nil {
+		return nil, err
+	}
+	if s.cur != "" {
+		s.chunks = append(s.chunks, s.cur)
+	}
+	return s.chunks, nil
+}
+
+// tokenSplitter holds the state of one SplitByTokens call.
+type tokenSplitter struct {
+	ctx    context.Context
+	c      *Client
+	max    int
+	scale  float64 // API tokens per EstimateTokens token, from the last count
+	chunks []string
+	cur    string // chunk being filled
+}
+
+// splitLevels segment text at successively finer boundaries. The last level
+// halves its input and is reapplied until segments fit.
+var splitLevels = []func(string) []string{
+	func(s string) []string { return splitAfter(s, paragraphBreak) },
+	func(s string) []string { return splitAfter(s, sentenceBreak) },
+	func(s string) []string { return splitAfter(s, wordBreak) },
+	splitHalves,
+}
+
+func (s *tokenSplitter) split(text string, level int) error {
+	segs := splitLevels[level](text)
+	for i := 0; i < len(segs); {
+		// Try the run of segments the estimate says fits after cur, halving
+		// it until the API agrees. A run of one is always tried, so chunks
+		// are packed as greedily as counting one segment at a time would.
+		n := s.estimateRun(segs[i:])
+		for ; n > 0; n /= 2 {
+			ok, err := s.fits(s.cur + strings.Join(segs[i:i+n], ""))
+			if err != nil {
+				return err
+			}
+			if ok {
+				break
+			}
+		}
+		if n > 0 {
+			s.cur += strings.Join(segs[i:i+n], "")
+			i += n
+			continue
+		}
+		if s.cur != "" {
+			s.chunks = append(s.chunks, s.cur)
+			s.cur = ""
+			continue
+		}
+		seg := segs[i]
+		i++
+		next := level + 1
+		if next == len(splitLevels) {
+			if utf8.RuneCountInString(seg) <= 1 {
+				return fmt.Errorf("%w: %q alone exceeds %d tokens", ErrPromptTooLarge, seg, s.max)
+			}
+			next = level
+		}
+		if err := s.split(seg, next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// estimateRun returns how many of segs, at least one, are estimated to fit
+// after cur.
+func (s *tokenSplitter) estimateRun(segs []string) int {
+	runes := utf8.RuneCountInString(s.cur)
+	for n, seg := range segs {
+		runes += utf8.RuneCountInString(seg)
+		est := math.Ceil(float64(runes) / charsPerToken * s.scale)
+		if n > 0 && est > float64(s.max) {
+			return n
+		}
+	}
+	return len(segs)
+}
+
+// fits counts text on its own, without the client's request defaults, and
+// rescales the local estimate by the result.
+func (s *tokenSplitter) fits(text string) (bool, error) {
+	n, err := s.c.countTokens(s.ctx, &Request{Contents: promptContents(text)}, "")
+	if err != nil {
+		return false, err
+	}
+	if est := EstimateTokens(text); est > 0 && n > 0 {
+		s.scale = float64(n) / float64(est)
+	}
+	return n <= s.max, nil
+}
+
+// splitAfter cuts s after every match of sep.
+func splitAfter(s string, sep *regexp.Regexp) []string {
+	var segs []string
+	start := 0
+	for _, m := range sep.FindAllStringIndex(s, -1) {
+		if m[1] > start && m[1] < len(s) {
+			segs = append(segs, s[start:m[1]])
+			start = m[1]
+		}
+	}
+	return append(segs, s[start:])
+}
+
+// splitHalves cuts s in two at the rune boundary nearest its middle.
+func splitHalves(s string) []string {
+	mid := len(s) / 2
+	for mid > 0 && !utf8.RuneStart(s[mid]) {
+		mid--
+	}
+	if mid == 0 {
+		return []string{s}
+	}
+	return []string{s[:mid], s[mid:]}
+}
@@ -0,0 +1,316 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"abc", 1},
+		{"abcd", 1},
+		{"abcde", 2},
+		{strings.Repeat("x", 400), 100},
+		{"héllo", 2}, // counted in runes, not bytes
+	}
+	for _, tt := range tests {
+		if got := EstimateTokens(tt.text); got != tt.want {
+			t.Errorf("EstimateTokens(%q): got %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestFitsContext(t *testing.T) {
+	c := mustNew(t, "key", WithModelInfo(Model{Name: "models/tiny", InputTokenLimit: 1000}))
+
+	fits, err := c.FitsContext("short prompt", WithMaxTokens(100))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !fits {
+		t.Error("short prompt should fit")
+	}
+
+	fits, err = c.FitsContext(strings.Repeat("word ", 1000), WithMaxTokens(100))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fits {
+		t.Error("long prompt should not fit a 1000-token limit")
+	}
+}
+
+func TestFitsContext_CountsMaxTokens(t *testing.T) {
+	c := mustNew(t, "key", WithModelInfo(Model{InputTokenLimit: 1000}))
+
+	// 400 chars ≈ 100 tokens; 100 + 900 fits exactly, 100 + 901 does not.
+	prompt := strings.Repeat("x", 400)
+	if fits, _ := c.FitsContext(prompt, WithMaxTokens(900)); !fits {
+		t.Error("expected prompt to fit at the exact limit")
+	}
+	if fits, _ := c.FitsContext(prompt, WithMaxTokens(901)); fits {
+		t.Error("expected prompt to exceed the limit by one token")
+	}
+}
+
+func TestFitsContext_NoLimit(t *testing.T) {
+	c := mustNew(t, "key")
+	_, err := c.FitsContext("test")
+	if err == nil || !strings.Contains(err.Error(), "no input token limit") {
+		t.Fatalf("expected missing limit error, got %v", err)
+	}
+}
+
+func TestFitsContext_InvalidOptions(t *testing.T) {
+	c := mustNew(t, "key", WithModelInfo(Model{InputTokenLimit: 1000}))
+	if _, err := c.FitsContext("test", WithMaxTokens(0)); err == nil {
+		t.Fatal("expected validation error for maxTokens=0")
+	}
+}
+
+// methodDoer answers each model method (the URL suffix after ':') with a
+// canned body and records the methods called.
+type methodDoer struct {
+	bodies  map[string]string
+	calls   []string
+	reqBody map[string][]byte
+}
+
+func (m *methodDoer) Do(req *http.Request) (*http.Response, error) {
+	_, method, _ := strings.Cut(req.URL.Path, ":")
+	m.calls = append(m.calls, method)
+	if m.reqBody == nil {
+		m.reqBody = make(map[string][]byte)
+	}
+	m.reqBody[method], _ = io.ReadAll(req.Body)
+	return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(m.bodies[method]))}, nil
+}
+
+func TestWithTokenGuard(t *testing.T) {
+	tests := []struct {
+		name      string
+		guard     int
+		wantErr   bool
+		wantCalls []string
+	}{
+		{"passes", 100, false, []string{"countTokens", "generateContent"}},
+		{"at limit", 42, false, []string{"countTokens", "generateContent"}},
+		{"trips", 41, true, []string{"countTokens"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doer := &methodDoer{bodies: map[string]string{
+				"countTokens":     `{"totalTokens":42}`,
+				"generateContent": okBody,
+			}}
+			c := mustNew(t, "key", WithDoer(doer), WithModel("gemini-2.5-flash"))
+
+			_, err := c.Generate(context.Background(), "hello", WithTokenGuard(tt.guard))
+			if tt.wantErr != errors.Is(err, ErrPromptTooLarge) {
+				t.Fatalf("err = %v, want ErrPromptTooLarge: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(doer.calls, ",") != strings.Join(tt.wantCalls, ",") {
+				t.Errorf("calls: got %v, want %v", doer.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestWithTokenGuard_OptIn(t *testing.T) {
+	doer := &methodDoer{bodies: map[string]string{"generateContent": okBody}}
+	c := mustNew(t, "key", WithDoer(doer))
+
+	if _, err := c.Generate(context.Background(), "hello"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(doer.calls) != 1 || doer.calls[0] != "generateContent" {
+		t.Errorf("countTokens should not be called without the guard, got %v", doer.calls)
+	}
+	if _, err := c.Generate(context.Background(), "hello", WithTokenGuard(-1)); err == nil {
+		t.Error("expected error for negative guard")
+	}
+}
+
+func TestCountTokens(t *testing.T) {
+	doer := &methodDoer{bodies: map[string]string{"countTokens": `{"totalTokens":9}`}}
+	c := mustNew(t, "key", WithDoer(doer), WithModel("gemini-2.5-flash"), WithDefaultSystemInstruction("be brief"))
+
+	n, err := c.CountTokens(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 9 {
+		t.Errorf("tokens: got %d, want 9", n)
+	}
+	var body struct {
+		GenerateContentRequest struct {
+			Model             string    `json:"model"`
+			Contents          []Content `json:"contents"`
+			SystemInstruction *Content  `json:"systemInstruction"`
+		} `json:"generateContentRequest"`
+	}
+	if err := json.Unmarshal(doer.reqBody["countTokens"], &body); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	g := body.GenerateContentRequest
+	if g.Model != "models/gemini-2.5-flash" {
+		t.Errorf("model: got %q", g.Model)
+	}
+	if len(g.Contents) != 1 || g.Contents[0].Parts[0].Text != "hello" || g.SystemInstruction == nil {
+		t.Errorf("request not wrapped: %s", doer.reqBody["countTokens"])
+	}
+}
+
+// wordTokens counts whitespace-separated words, plus one for each rune of a
+// word past the tenth.
+func wordTokens(s string) int {
+	n := 0
+	for _, w := range strings.Fields(s) {
+		n += 1 + max(0, len([]rune(w))-10)
+	}
+	return n
+}
+
+// wordCountDoer answers countTokens with wordTokens of the prompt.
+func wordCountDoer(calls *int) Doer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		*calls++
+		var body countTokensRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			return nil, err
+		}
+		n := wordTokens(body.GenerateContentRequest.Contents[0].Parts[0].Text)
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(fmt.Sprintf(`{"totalTokens":%d}`, n)))}, nil
+	})
+}
+
+func TestSplitByTokens(t *testing.T) {
+	text := "One two three. Four five.\n\n" +
+		"Six seven eight nine ten eleven. Twelve.\n\n" +
+		"Thirteen fourteen fifteen sixteen seventeen eighteen nineteen"
+	var calls int
+	c := mustNew(t, "key", WithDoer(wordCountDoer(&calls)))
+
+	chunks, err := c.SplitByTokens(context.Background(), text, 6)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"One two three. Four five.\n\n",
+		"Six seven eight nine ten eleven. ",
+		"Twelve.\n\n",
+		"Thirteen fourteen fifteen sixteen seventeen eighteen ",
+		"nineteen",
+	}
+	if !slices.Equal(chunks, want) {
+		t.Errorf("chunks:\ngot  %q\nwant %q", chunks, want)
+	}
+	if strings.Join(chunks, "") != text {
+		t.Error("chunks do not concatenate to the original text")
+	}
+	if calls == 0 {
+		t.Error("expected countTokens calls")
+	}
+}
+
+func TestSplitByTokens_LongWord(t *testing.T) {
+	text := "short " + strings.Repeat("x", 30)
+	var calls int
+	c := mustNew(t, "key", WithDoer(wordCountDoer(&calls)))
+
+	chunks, err := c.SplitByTokens(context.Background(), text, 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(chunks, "") != text {
+		t.Errorf("chunks do not concatenate to the original text: %q", chunks)
+	}
+	for _, ch := range chunks {
+		if wordTokens(ch) > 5 {
+			t.Errorf("chunk %q over budget", ch)
+		}
+	}
+}
+
+func TestSplitByTokens_CountsChunkAlone(t *testing.T) {
+	var calls int
+	counter := wordCountDoer(&calls)
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		if strings.Contains(string(body), "systemInstruction") || strings.Contains(string(body), "PREFIX") {
+			t.Errorf("count request includes client defaults: %s", body)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		return counter.Do(req)
+	})
+	c := mustNew(t, "key", WithDoer(doer),
+		WithDefaultSystemInstruction("a long system instruction that would eat the budget"),
+		WithPromptPreprocessor(func(s string) string { return "PREFIX " + s }))
+
+	chunks, err := c.SplitByTokens(context.Background(), "one two three four", 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(chunks, []string{"one two three four"}) {
+		t.Errorf("chunks: got %q", chunks)
+	}
+}
+
+func TestSplitByTokens_BatchesCounts(t *testing.T) {
+	text := strings.Repeat("alpha beta gamma delta.\n\n", 200)
+	var calls int
+	c := mustNew(t, "key", WithDoer(wordCountDoer(&calls)))
+
+	chunks, err := c.SplitByTokens(context.Background(), text, 40)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(chunks, "") != text {
+		t.Error("chunks do not concatenate to the original text")
+	}
+	if len(chunks) != 20 {
+		t.Errorf("chunks: got %d, want 20 of 10 paragraphs each", len(chunks))
+	}
+	// Counting one paragraph at a time would take over 200 calls.
+	if calls > 60 {
+		t.Errorf("countTokens calls: got %d, want at most 60", calls)
+	}
+}
+
+func TestSplitByTokens_Invalid(t *testing.T) {
+	var calls int
+	c := mustNew(t, "key", WithDoer(wordCountDoer(&calls)))
+
+	if _, err := c.SplitByTokens(context.Background(), "text", 0); err == nil {
+		t.Error("expected error for maxTokens 0")
+	}
+	if chunks, err := c.SplitByTokens(context.Background(), "", 5); err != nil || chunks != nil {
+		t.Errorf("empty text: got (%q, %v)", chunks, err)
+	}
+	if calls != 0 {
+		t.Errorf("expected no API calls, got %d", calls)
+	}
+
+	tooBig := DoerFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"totalTokens":99}`))}, nil
+	})
+	c = mustNew(t, "key", WithDoer(tooBig))
+	if _, err := c.SplitByTokens(context.Background(), "ab", 5); !errors.Is(err, ErrPromptTooLarge) {
+		t.Errorf("unsplittable text: got %v, want ErrPromptTooLarge", err)
+	}
+}
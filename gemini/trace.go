@@ -0,0 +1,55 @@
+package gemini
+
+import "context"
+
+// Tracer starts spans around API calls. It mirrors the subset of an
+// OpenTelemetry trace.Tracer the client needs, so callers can adapt one
+// without this package depending on OpenTelemetry.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced operation started by a Tracer.
+type Span interface {
+	SetAttribute(key string, value any)
+	RecordError(err error)
+	End()
+}
+
+// Span attribute keys set by the client.
+const (
+	AttrModel           = "gemini.model"
+	AttrStatusCode      = "http.status_code"
+	AttrPromptTokens    = "gemini.prompt_tokens"
+	AttrCandidateTokens = "gemini.candidate_tokens"
+	AttrTotalTokens     = "gemini.total_tokens"
+)
+
+// WithTracer wraps each non-streaming API call in a span named after the
+// method, e.g. "gemini.generateContent" or "gemini.countTokens", carrying
+// the model, HTTP status code, and token counts. Failed calls record their
+// error on the span. Tracing is off by default.
+func WithTracer(t Tracer) Option {
+	return func(c *Client) { c.tracer = t }
+}
+
+// endSpan annotates span with the outcome of a request and ends it.
+func (c *Client) endSpan(span Span, status int, respBody any, err error) {
+	span.SetAttribute(AttrModel, c.model)
+	if status != 0 {
+		span.SetAttribute(AttrStatusCode, status)
+	}
+	if err != nil {
+		span.RecordError(err)
+	} else {
+		switch r := respBody.(type) {
+		case *Response:
+			span.SetAttribute(AttrPromptTokens, r.UsageMetadata.PromptTokenCount)
+			span.SetAttribute(AttrCandidateTokens, r.UsageMetadata.CandidatesTokenCount)
+			span.SetAttribute(AttrTotalTokens, r.UsageMetadata.TotalTokenCount)
+		case *countTokensResponse:
+			span.SetAttribute(AttrPromptTokens, r.TotalTokens)
+		}
+	}
+	span.End()
+}
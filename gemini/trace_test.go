@@ -0,0 +1,96 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+type fakeSpan struct {
+	name  string
+	attrs map[string]any
+	err   error
+	ended bool
+}
+
+func (s *fakeSpan) SetAttribute(key string, value any) { s.attrs[key] = value }
+func (s *fakeSpan) RecordError(err error)              { s.err = err }
+func (s *fakeSpan) End()                               { s.ended = true }
+
+type spanKey struct{}
+
+// fakeTracer records every span it starts and tags the context with it.
+type fakeTracer struct {
+	mu    sync.Mutex
+	spans []*fakeSpan
+}
+
+func (f *fakeTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := &fakeSpan{name: name, attrs: map[string]any{}}
+	f.spans = append(f.spans, s)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func TestWithTracer_Success(t *testing.T) {
+	tracer := &fakeTracer{}
+	mock := &mockDoer{statusCode: 200, respBody: `{"candidates":[{"content":{"parts":[{"text":"ok"}]}}],
+		"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":2,"totalTokenCount":6}}`}
+	c := mustNew(t, "key", WithDoer(mock), WithModel("m"), WithTracer(tracer))
+
+	if _, err := c.Generate(context.Background(), "test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tracer.spans) != 1 {
+		t.Fatalf("spans: got %d, want 1", len(tracer.spans))
+	}
+	s := tracer.spans[0]
+	if s.name != "gemini.generateContent" || !s.ended || s.err != nil {
+		t.Errorf("span: got %+v", s)
+	}
+	want := map[string]any{AttrModel: "m", AttrStatusCode: 200, AttrPromptTokens: 4, AttrCandidateTokens: 2, AttrTotalTokens: 6}
+	for k, v := range want {
+		if s.attrs[k] != v {
+			t.Errorf("%s: got %v, want %v", k, s.attrs[k], v)
+		}
+	}
+	if mock.req.Context().Value(spanKey{}) != s {
+		t.Error("request should carry the span context")
+	}
+}
+
+func TestWithTracer_ErrorMarksSpan(t *testing.T) {
+	tracer := &fakeTracer{}
+	mock := &mockDoer{statusCode: 500, respBody: `{"error":{"code":500,"message":"boom","status":"INTERNAL"}}`}
+	c := mustNew(t, "key", WithDoer(mock), WithTracer(tracer))
+
+	if _, err := c.Generate(context.Background(), "test"); err == nil {
+		t.Fatal("expected error")
+	}
+	s := tracer.spans[0]
+	var apiErr *APIError
+	if !errors.As(s.err, &apiErr) || apiErr.StatusCode != 500 {
+		t.Errorf("span error: got %v", s.err)
+	}
+	if s.attrs[AttrStatusCode] != 500 || !s.ended {
+		t.Errorf("span: got %+v", s)
+	}
+	if _, ok := s.attrs[AttrTotalTokens]; ok {
+		t.Error("failed calls should not report token counts")
+	}
+}
+
+func TestWithTracer_CountTokens(t *testing.T) {
+	tracer := &fakeTracer{}
+	mock := &mockDoer{statusCode: 200, respBody: `{"totalTokens":12}`}
+	c := mustNew(t, "key", WithDoer(mock), WithTracer(tracer))
+
+	if _, err := c.CountTokens(context.Background(), "test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s := tracer.spans[0]; s.name != "gemini.countTokens" || s.attrs[AttrPromptTokens] != 12 {
+		t.Errorf("span: got %+v", s)
+	}
+}
@@ -1,55 +1,367 @@
 // Package gemini provides a client for the Google Gemini generative AI API.
 package gemini
 
-import "strings"
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
 
 // Request types
 
 // Request represents a request to the Gemini generateContent endpoint.
 type Request struct {
-	Contents         []Content        `json:"contents"`
-	GenerationConfig GenerationConfig `json:"generationConfig"`
-	Tools            []Tool           `json:"tools,omitempty"`
+	SystemInstruction *Content          `json:"systemInstruction,omitempty"`
+	Contents          []Content         `json:"contents"`
+	GenerationConfig  GenerationConfig  `json:"generationConfig"`
+	Tools             []Tool            `json:"tools,omitempty"`
+	ToolConfig        *ToolConfig       `json:"toolConfig,omitempty"`
+	SafetySettings    []SafetySetting   `json:"safetySettings,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
 }
 
 // Content represents a content block containing parts.
 type Content struct {
-	Role  string `json:"role"`
+	Role  string `json:"role,omitempty"`
 	Parts []Part `json:"parts"`
 }
 
+// Content roles.
+const (
+	RoleUser     = "user"
+	RoleModel    = "model"
+	RoleFunction = "function"
+	RoleTool     = "tool"
+)
+
+// Message is a plain-text chat turn, a lighter alternative to Content for
+// conversations without media or function calls.
+type Message struct {
+	Role string `json:"role"` // RoleUser or RoleModel
+	Text string `json:"text"`
+}
+
+// MessagesToContents converts messages to contents for GenerateContents,
+// one single-part content per message.
+func MessagesToContents(msgs []Message) []Content {
+	contents := make([]Content, len(msgs))
+	for i, m := range msgs {
+		contents[i] = Content{Role: m.Role, Parts: []Part{{Text: m.Text}}}
+	}
+	return contents
+}
+
+// ContentsToMessages converts contents to messages, one per content, joining
+// the text of multi-part contents. Non-text parts are dropped, so a content
+// holding only media or function calls becomes a message with empty text.
+func ContentsToMessages(contents []Content) []Message {
+	msgs := make([]Message, len(contents))
+	for i, c := range contents {
+		var b strings.Builder
+		for _, p := range c.Parts {
+			b.WriteString(p.Text)
+		}
+		msgs[i] = Message{Role: c.Role, Text: b.String()}
+	}
+	return msgs
+}
+
 // Part represents a single part of a content block.
+// Exactly one of the fields should be set.
 type Part struct {
-	Text string `json:"text"`
+	Text             string            `json:"text,omitempty"`
+	FunctionCall     *FunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
+	InlineData       *InlineData       `json:"inlineData,omitempty"`
+	FileData         *FileData         `json:"fileData,omitempty"`
+	VideoMetadata    *VideoMetadata    `json:"videoMetadata,omitempty"`
+}
+
+// FileData references media uploaded via the File API.
+type FileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+// VideoMetadata selects a clip and frame sampling rate for a video part.
+// Offsets are durations in the API's string form, e.g. "1.5s".
+type VideoMetadata struct {
+	StartOffset string  `json:"startOffset,omitempty"`
+	EndOffset   string  `json:"endOffset,omitempty"`
+	FPS         float64 `json:"fps,omitempty"`
+}
+
+// FunctionCall is a model request to invoke a declared function.
+type FunctionCall struct {
+	Name string         `json:"name"`
+	Args map[string]any `json:"args,omitempty"`
+
+	// PartialArgs and WillContinue carry a call streamed across chunks.
+	// GenerateStreamCallback folds them into Args on the aggregated response.
+	PartialArgs  []PartialArg `json:"partialArgs,omitempty"`
+	WillContinue bool         `json:"willContinue,omitempty"`
+
+	// continuing tracks JSON paths whose string value is still streaming.
+	continuing map[string]bool
+}
+
+// PartialArg is a fragment of a streamed function call argument, addressed
+// by a JSON path such as "$.location" or "$.filter.city". A string value
+// with WillContinue set is continued by the next fragment for the same path.
+type PartialArg struct {
+	JSONPath     string   `json:"jsonPath"`
+	StringValue  *string  `json:"stringValue,omitempty"`
+	NumberValue  *float64 `json:"numberValue,omitempty"`
+	BoolValue    *bool    `json:"boolValue,omitempty"`
+	NullValue    *string  `json:"nullValue,omitempty"`
+	WillContinue bool     `json:"willContinue,omitempty"`
+}
+
+// FunctionResponse carries the result of a function call back to the model.
+type FunctionResponse struct {
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+// NewFunctionResponsePart returns a part reporting the result of the named function.
+func NewFunctionResponsePart(name string, response map[string]any) Part {
+	return Part{FunctionResponse: &FunctionResponse{Name: name, Response: response}}
+}
+
+// NewInlineDataPart returns a part carrying raw media bytes, base64-encoded
+// for the request.
+func NewInlineDataPart(mimeType string, data []byte) Part {
+	return Part{InlineData: &InlineData{MimeType: mimeType, Data: base64.StdEncoding.EncodeToString(data)}}
 }
 
 // GenerationConfig controls generation parameters.
 type GenerationConfig struct {
-	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
-	Temperature     *float64 `json:"temperature,omitempty"`
+	MaxOutputTokens    int      `json:"maxOutputTokens,omitempty"`
+	Temperature        *float64 `json:"temperature,omitempty"`
+	ResponseModalities []string `json:"responseModalities,omitempty"`
+	ResponseMimeType   string   `json:"responseMimeType,omitempty"`
+	CandidateCount     int      `json:"candidateCount,omitempty"`
+	ResponseSchema     *Schema  `json:"responseSchema,omitempty"`
+	ResponseLogprobs   bool     `json:"responseLogprobs,omitempty"`
+	Logprobs           int      `json:"logprobs,omitempty"`
+	TopP               *float64 `json:"topP,omitempty"`
+	TopK               *int     `json:"topK,omitempty"`
+	Seed               *int     `json:"seed,omitempty"`
+	StopSequences      []string `json:"stopSequences,omitempty"`
+	AudioTimestamp     bool     `json:"audioTimestamp,omitempty"`
+}
+
+// Response modalities for GenerationConfig.ResponseModalities.
+const (
+	ModalityText  = "TEXT"
+	ModalityImage = "IMAGE"
+	ModalityAudio = "AUDIO"
+)
+
+// Harm categories for SafetySetting.Category.
+const (
+	HarmCategoryHarassment       = "HARM_CATEGORY_HARASSMENT"
+	HarmCategoryHateSpeech       = "HARM_CATEGORY_HATE_SPEECH"
+	HarmCategorySexuallyExplicit = "HARM_CATEGORY_SEXUALLY_EXPLICIT"
+	HarmCategoryDangerousContent = "HARM_CATEGORY_DANGEROUS_CONTENT"
+	HarmCategoryCivicIntegrity   = "HARM_CATEGORY_CIVIC_INTEGRITY"
+)
+
+// harmCategories lists the categories WithSafetyThreshold expands to.
+var harmCategories = []string{
+	HarmCategoryHarassment,
+	HarmCategoryHateSpeech,
+	HarmCategorySexuallyExplicit,
+	HarmCategoryDangerousContent,
+	HarmCategoryCivicIntegrity,
+}
+
+// Block thresholds for SafetySetting.Threshold.
+const (
+	HarmBlockNone           = "BLOCK_NONE"
+	HarmBlockOnlyHigh       = "BLOCK_ONLY_HIGH"
+	HarmBlockMediumAndAbove = "BLOCK_MEDIUM_AND_ABOVE"
+	HarmBlockLowAndAbove    = "BLOCK_LOW_AND_ABOVE"
+	HarmBlockOff            = "OFF"
+)
+
+// SafetySetting sets the blocking threshold for a single harm category.
+type SafetySetting struct {
+	Category  string `json:"category"`
+	Threshold string `json:"threshold"`
 }
 
 // Tool represents a tool available to the model.
 type Tool struct {
-	GoogleSearch *GoogleSearch `json:"googleSearch,omitempty"`
+	GoogleSearch         *GoogleSearch         `json:"googleSearch,omitempty"`
+	FunctionDeclarations []FunctionDeclaration `json:"functionDeclarations,omitempty"`
 }
 
 // GoogleSearch enables grounding with Google Search.
 type GoogleSearch struct{}
 
+// FunctionDeclaration describes a function the model may ask the caller to invoke.
+type FunctionDeclaration struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Parameters  *Schema `json:"parameters,omitempty"`
+}
+
+// Schema describes the shape of function parameters using the OpenAPI subset
+// accepted by the Gemini API.
+type Schema struct {
+	Type        string             `json:"type"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	// Enum restricts a STRING schema to the listed values.
+	Enum []string `json:"enum,omitempty"`
+	// PropertyOrdering lists property names in the order the model should
+	// emit them, stabilizing key order in generated JSON.
+	PropertyOrdering []string `json:"propertyOrdering,omitempty"`
+}
+
+// EnumSchema returns a STRING schema limited to values. Used with
+// WithResponseSchema, the response is a JSON string holding exactly one of
+// them, e.g. for classification; decode it with Response.JSON into a string.
+func EnumSchema(values ...string) *Schema {
+	return &Schema{Type: "STRING", Enum: values}
+}
+
+// Function calling modes for FunctionCallingConfig.Mode.
+const (
+	FunctionCallingAuto = "AUTO" // model decides between text and a function call
+	FunctionCallingAny  = "ANY"  // model must call one of the (allowed) functions
+	FunctionCallingNone = "NONE" // model must not call functions
+)
+
+// ToolConfig controls how the model uses the tools supplied in the request.
+type ToolConfig struct {
+	FunctionCallingConfig *FunctionCallingConfig `json:"functionCallingConfig,omitempty"`
+}
+
+// FunctionCallingConfig constrains function calling behavior.
+// AllowedFunctionNames is only honored by the API when Mode is FunctionCallingAny.
+type FunctionCallingConfig struct {
+	Mode                 string   `json:"mode,omitempty"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
 // Response types
 
+// countTokensRequest is the body of a countTokens call. Wrapping the full
+// generate request counts system instructions and tools as well as contents.
+type countTokensRequest struct {
+	GenerateContentRequest countTokensGenerateRequest `json:"generateContentRequest"`
+}
+
+type countTokensGenerateRequest struct {
+	Model string `json:"model"`
+	*Request
+}
+
+// countTokensResponse is the result of a countTokens call.
+type countTokensResponse struct {
+	TotalTokens int `json:"totalTokens"`
+}
+
 // Response represents the response from the Gemini generateContent endpoint.
 type Response struct {
-	Candidates    []Candidate   `json:"candidates"`
-	UsageMetadata UsageMetadata `json:"usageMetadata"`
+	Candidates     []Candidate     `json:"candidates"`
+	PromptFeedback *PromptFeedback `json:"promptFeedback,omitempty"`
+	UsageMetadata  UsageMetadata   `json:"usageMetadata"`
+
+	// ResponseID is the server's x-goog-request-id header, for correlating
+	// the call with Google-side logs. It is not part of the JSON body.
+	ResponseID string `json:"-"`
+
+	// Attempts is the number of HTTP attempts the call took: 1 unless
+	// WithRetry retried it, and 0 when the response came from WithCache.
+	// It is not part of the JSON body.
+	Attempts int `json:"-"`
+
+	// Model is the model that served the call, e.g. the one WithModelSplit
+	// chose. It is not part of the JSON body.
+	Model string `json:"-"`
+
+	// SearchFallback is set when WithGoogleSearchFallback retried the call
+	// without Google Search because the model does not support it, so the
+	// answer is not grounded. It is not part of the JSON body.
+	SearchFallback bool `json:"-"`
+}
+
+// PromptFeedback reports whether the prompt itself was blocked.
+type PromptFeedback struct {
+	BlockReason   string         `json:"blockReason,omitempty"`
+	SafetyRatings []SafetyRating `json:"safetyRatings,omitempty"`
 }
 
 // Candidate represents a single generation candidate.
 type Candidate struct {
-	Content       ResponseContent `json:"content"`
-	FinishReason  string          `json:"finishReason"`
-	SafetyRatings []SafetyRating  `json:"safetyRatings"`
+	Content        ResponseContent `json:"content"`
+	FinishReason   FinishReason    `json:"finishReason"`
+	SafetyRatings  []SafetyRating  `json:"safetyRatings"`
+	AvgLogprobs    float64         `json:"avgLogprobs,omitempty"`
+	LogprobsResult *LogprobsResult `json:"logprobsResult,omitempty"`
+
+	CitationMetadata *CitationMetadata `json:"citationMetadata,omitempty"`
+}
+
+// ExceedsSafety reports whether any of the candidate's safety ratings is at
+// or above p, one of the Probability constants. It is false for any other p.
+func (c Candidate) ExceedsSafety(p Probability) bool {
+	for _, r := range c.SafetyRatings {
+		if r.AtLeast(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// CitationMetadata lists the sources a candidate's text quotes from.
+type CitationMetadata struct {
+	CitationSources []CitationSource `json:"citationSources,omitempty"`
+}
+
+// CitationSource attributes the candidate text between byte offsets
+// StartIndex and EndIndex to a source. URI and License are set when known.
+type CitationSource struct {
+	StartIndex int    `json:"startIndex,omitempty"`
+	EndIndex   int    `json:"endIndex,omitempty"`
+	URI        string `json:"uri,omitempty"`
+	License    string `json:"license,omitempty"`
+}
+
+// LogprobsResult holds the token log-probabilities returned when a request
+// sets ResponseLogprobs. ChosenCandidates has one entry per generated token;
+// TopCandidates, when Logprobs was set, lists the most likely alternatives
+// at each of those steps.
+type LogprobsResult struct {
+	TopCandidates    []TopLogprobs  `json:"topCandidates,omitempty"`
+	ChosenCandidates []TokenLogprob `json:"chosenCandidates,omitempty"`
+}
+
+// TopLogprobs lists the most likely tokens at one decoding step, in
+// descending order of log-probability.
+type TopLogprobs struct {
+	Candidates []TokenLogprob `json:"candidates,omitempty"`
+}
+
+// TokenLogprob is a single token and its log-probability.
+type TokenLogprob struct {
+	Token          string  `json:"token"`
+	TokenID        int     `json:"tokenId"`
+	LogProbability float64 `json:"logProbability"`
+}
+
+// TokenLogprobs returns the log-probability of each token the candidate
+// generated, or nil when the response carries no logprobs.
+func (c *Candidate) TokenLogprobs() []TokenLogprob {
+	if c == nil || c.LogprobsResult == nil {
+		return nil
+	}
+	return c.LogprobsResult.ChosenCandidates
 }
 
 // ResponseContent represents the content of a candidate response.
@@ -60,7 +372,49 @@ type ResponseContent struct {
 
 // ResponsePart represents a single part of a candidate response.
 type ResponsePart struct {
-	Text string `json:"text"`
+	Text         string        `json:"text,omitempty"`
+	FunctionCall *FunctionCall `json:"functionCall,omitempty"`
+	InlineData   *InlineData   `json:"inlineData,omitempty"`
+	// Thought marks a text part as a summary of the model's reasoning rather
+	// than part of the answer. Text excludes it; read it with Thoughts.
+	Thought bool `json:"thought,omitempty"`
+}
+
+// PartKind identifies which field of a ResponsePart is populated.
+type PartKind string
+
+// Part kinds returned by ResponsePart.Kind.
+const (
+	PartKindText         PartKind = "text"
+	PartKindFunctionCall PartKind = "functionCall"
+	PartKindInlineData   PartKind = "inlineData"
+	PartKindUnknown      PartKind = "unknown"
+)
+
+// Kind reports the type of content carried by the part.
+func (p ResponsePart) Kind() PartKind {
+	switch {
+	case p.FunctionCall != nil:
+		return PartKindFunctionCall
+	case p.InlineData != nil:
+		return PartKindInlineData
+	case p.Text != "":
+		return PartKindText
+	default:
+		return PartKindUnknown
+	}
+}
+
+// InlineData holds base64-encoded media, such as a generated image or
+// audio sent with a request.
+type InlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+// Decode returns the raw bytes of the base64-encoded data.
+func (d InlineData) Decode() ([]byte, error) {
+	return base64.StdEncoding.DecodeString(d.Data)
 }
 
 // UsageMetadata contains token usage information.
@@ -68,30 +422,275 @@ type UsageMetadata struct {
 	PromptTokenCount     int `json:"promptTokenCount"`
 	CandidatesTokenCount int `json:"candidatesTokenCount"`
 	TotalTokenCount      int `json:"totalTokenCount"`
+	// CachedContentTokenCount is the part of the prompt served from a
+	// cached context.
+	CachedContentTokenCount int `json:"cachedContentTokenCount,omitempty"`
+}
+
+// Pricing holds caller-supplied per-model rates in dollars per 1,000 tokens.
+// Rates change over time, so the package ships none.
+type Pricing struct {
+	InputPer1K  float64 // prompt tokens
+	OutputPer1K float64 // candidate tokens
+}
+
+// Cost returns the dollar cost of the prompt and candidate tokens at p.
+func (u UsageMetadata) Cost(p Pricing) float64 {
+	return float64(u.PromptTokenCount)/1000*p.InputPer1K +
+		float64(u.CandidatesTokenCount)/1000*p.OutputPer1K
 }
 
 // SafetyRating represents a safety rating for a candidate.
 type SafetyRating struct {
-	Category    string `json:"category"`
-	Probability string `json:"probability"`
+	Category    string      `json:"category"`
+	Probability Probability `json:"probability"`
+	Blocked     bool        `json:"blocked,omitempty"`
+}
+
+// AtLeast reports whether the rating's probability is p, one of the
+// Probability constants, or higher. Unknown rated probabilities rank lowest;
+// an unknown threshold p matches nothing.
+func (r SafetyRating) AtLeast(p Probability) bool {
+	threshold, ok := probabilityRanks[p]
+	if !ok {
+		return false
+	}
+	return probabilityRanks[r.Probability] >= threshold
+}
+
+// Probability is a harm probability level as sent by the API. Values the
+// constants do not name are kept as-is.
+type Probability string
+
+// Harm probabilities for SafetyRating.Probability, lowest first.
+const (
+	ProbabilityUnspecified Probability = "HARM_PROBABILITY_UNSPECIFIED"
+	ProbabilityNegligible  Probability = "NEGLIGIBLE"
+	ProbabilityLow         Probability = "LOW"
+	ProbabilityMedium      Probability = "MEDIUM"
+	ProbabilityHigh        Probability = "HIGH"
+)
+
+// probabilityRanks orders the Probability constants.
+var probabilityRanks = map[Probability]int{
+	ProbabilityUnspecified: 0,
+	ProbabilityNegligible:  1,
+	ProbabilityLow:         2,
+	ProbabilityMedium:      3,
+	ProbabilityHigh:        4,
+}
+
+// FinishReason is why a candidate stopped generating, as sent by the API.
+// Values the constants do not name are kept as-is.
+type FinishReason string
+
+// Finish reasons for Candidate.FinishReason.
+const (
+	FinishReasonUnspecified           FinishReason = "FINISH_REASON_UNSPECIFIED"
+	FinishReasonStop                  FinishReason = "STOP"
+	FinishReasonMaxTokens             FinishReason = "MAX_TOKENS"
+	FinishReasonSafety                FinishReason = "SAFETY"
+	FinishReasonRecitation            FinishReason = "RECITATION"
+	FinishReasonLanguage              FinishReason = "LANGUAGE"
+	FinishReasonBlocklist             FinishReason = "BLOCKLIST"
+	FinishReasonProhibitedContent     FinishReason = "PROHIBITED_CONTENT"
+	FinishReasonSPII                  FinishReason = "SPII"
+	FinishReasonMalformedFunctionCall FinishReason = "MALFORMED_FUNCTION_CALL"
+	FinishReasonOther                 FinishReason = "OTHER"
+)
+
+// Model types
+
+// Model describes a model's metadata as returned by the models endpoint.
+type Model struct {
+	Name             string  `json:"name"`
+	DisplayName      string  `json:"displayName,omitempty"`
+	InputTokenLimit  int     `json:"inputTokenLimit,omitempty"`
+	OutputTokenLimit int     `json:"outputTokenLimit,omitempty"`
+	Temperature      float64 `json:"temperature,omitempty"`
+	MaxTemperature   float64 `json:"maxTemperature,omitempty"`
+}
+
+// blockReason returns the prompt block reason, if any.
+func (r *Response) blockReason() string {
+	if r == nil || r.PromptFeedback == nil {
+		return ""
+	}
+	return r.PromptFeedback.BlockReason
 }
 
-// Text returns the concatenated text from all parts of the first candidate.
-// Returns empty string if r is nil or there are no candidates or parts.
+// Text returns the concatenated text from all parts of the first candidate,
+// excluding thought parts. Returns empty string if r is nil or there are no
+// candidates or parts.
 func (r *Response) Text() string {
 	if r == nil || len(r.Candidates) == 0 {
 		return ""
 	}
-	parts := r.Candidates[0].Content.Parts
-	if len(parts) == 0 {
+	return r.Candidates[0].Text()
+}
+
+// TextAt returns the concatenated text of candidate i, excluding thought
+// parts, or an error if i is out of range. Use it with WithCandidateCount.
+func (r *Response) TextAt(i int) (string, error) {
+	var n int
+	if r != nil {
+		n = len(r.Candidates)
+	}
+	if i < 0 || i >= n {
+		return "", fmt.Errorf("gemini: candidate index %d out of range [0,%d)", i, n)
+	}
+	return r.Candidates[i].Text(), nil
+}
+
+// Thoughts returns the concatenated thought summaries of the first
+// candidate, which the API includes when thinking output is requested.
+// Returns empty string if r is nil or there are no thought parts.
+func (r *Response) Thoughts() string {
+	if r == nil || len(r.Candidates) == 0 {
 		return ""
 	}
-	if len(parts) == 1 {
+	return r.Candidates[0].Thoughts()
+}
+
+// SelectCandidate returns the first candidate satisfying pred, e.g. one whose
+// text is valid JSON when several were requested with WithCandidateCount.
+// Nil-safe.
+func (r *Response) SelectCandidate(pred func(Candidate) bool) (*Candidate, bool) {
+	if r == nil {
+		return nil, false
+	}
+	for i := range r.Candidates {
+		if pred(r.Candidates[i]) {
+			return &r.Candidates[i], true
+		}
+	}
+	return nil, false
+}
+
+// FinishReasons returns every candidate's finish reason in candidate order.
+// Nil-safe.
+func (r *Response) FinishReasons() []FinishReason {
+	if r == nil {
+		return nil
+	}
+	reasons := make([]FinishReason, len(r.Candidates))
+	for i, c := range r.Candidates {
+		reasons[i] = c.FinishReason
+	}
+	return reasons
+}
+
+// UniqueTexts returns the candidates' texts in order with exact duplicates
+// removed, keeping the first occurrence. Nil-safe.
+func (r *Response) UniqueTexts() []string {
+	if r == nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(r.Candidates))
+	var texts []string
+	for _, c := range r.Candidates {
+		text := c.Text()
+		if seen[text] {
+			continue
+		}
+		seen[text] = true
+		texts = append(texts, text)
+	}
+	return texts
+}
+
+// CitationSources returns the citation sources of the first candidate.
+// Returns nil if r is nil or the candidate cites nothing.
+func (r *Response) CitationSources() []CitationSource {
+	if r == nil || len(r.Candidates) == 0 || r.Candidates[0].CitationMetadata == nil {
+		return nil
+	}
+	return r.Candidates[0].CitationMetadata.CitationSources
+}
+
+// continuePrompt is the user turn ContinuationContents appends after the
+// model's partial output.
+const continuePrompt = "Continue exactly where you left off. Do not repeat any text you have already written."
+
+// ContinuationContents builds a follow-up conversation for a response cut off
+// at MAX_TOKENS: the original prompt, the first candidate's partial text as a
+// model turn, and a user turn asking the model to continue. Pass it to
+// GenerateContents and append the new text to the partial output. If the
+// response has no text, only the original prompt is returned.
+func (r *Response) ContinuationContents(prompt string) []Content {
+	contents := promptContents(prompt)
+	partial := r.Text()
+	if partial == "" {
+		return contents
+	}
+	return append(contents,
+		Content{Role: RoleModel, Parts: []Part{{Text: partial}}},
+		Content{Role: RoleUser, Parts: []Part{{Text: continuePrompt}}},
+	)
+}
+
+// Text returns the concatenated text of the candidate's parts, excluding
+// thought parts.
+func (c Candidate) Text() string {
+	return c.partText(false)
+}
+
+// Thoughts returns the concatenated text of the candidate's thought parts.
+func (c Candidate) Thoughts() string {
+	return c.partText(true)
+}
+
+// partText concatenates the text of the parts whose Thought flag matches.
+func (c Candidate) partText(thought bool) string {
+	parts := c.Content.Parts
+	if len(parts) == 1 && parts[0].Thought == thought {
 		return parts[0].Text
 	}
 	var b strings.Builder
 	for _, p := range parts {
-		b.WriteString(p.Text)
+		if p.Thought == thought {
+			b.WriteString(p.Text)
+		}
 	}
 	return b.String()
 }
+
+// Parts returns the raw, ordered parts of the first candidate. Use
+// ResponsePart.Kind to distinguish text, function calls, and inline data.
+// Returns nil if r is nil or there are no candidates.
+func (r *Response) Parts() []ResponsePart {
+	if r == nil || len(r.Candidates) == 0 {
+		return nil
+	}
+	return r.Candidates[0].Content.Parts
+}
+
+// FunctionCalls returns the function calls requested by the first candidate, in order.
+// Returns nil if r is nil or the candidate made no calls.
+func (r *Response) FunctionCalls() []FunctionCall {
+	if r == nil || len(r.Candidates) == 0 {
+		return nil
+	}
+	var calls []FunctionCall
+	for _, p := range r.Candidates[0].Content.Parts {
+		if p.FunctionCall != nil {
+			calls = append(calls, *p.FunctionCall)
+		}
+	}
+	return calls
+}
+
+// Images returns the inline image parts of the first candidate, in order.
+// Returns nil if r is nil or the candidate contains no images.
+func (r *Response) Images() []InlineData {
+	if r == nil || len(r.Candidates) == 0 {
+		return nil
+	}
+	var images []InlineData
+	for _, p := range r.Candidates[0].Content.Parts {
+		if p.InlineData != nil && strings.HasPrefix(p.InlineData.MimeType, "image/") {
+			images = append(images, *p.InlineData)
+		}
+	}
+	return images
+}
@@ -0,0 +1,516 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNewFunctionResponsePart_JSON(t *testing.T) {
+	p := NewFunctionResponsePart("get_weather", map[string]any{"tempC": 18})
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	want := `{"functionResponse":{"name":"get_weather","response":{"tempC":18}}}`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+}
+
+func TestResponse_FunctionCallsNil(t *testing.T) {
+	var r *Response
+	if calls := r.FunctionCalls(); calls != nil {
+		t.Errorf("expected nil, got %+v", calls)
+	}
+	r = &Response{Candidates: []Candidate{{Content: ResponseContent{Parts: []ResponsePart{{Text: "hi"}}}}}}
+	if calls := r.FunctionCalls(); calls != nil {
+		t.Errorf("expected nil for text-only candidate, got %+v", calls)
+	}
+}
+
+func TestResponse_ImagesSkipsNonImageData(t *testing.T) {
+	r := &Response{Candidates: []Candidate{{Content: ResponseContent{Parts: []ResponsePart{
+		{InlineData: &InlineData{MimeType: "audio/wav", Data: "AAAA"}},
+		{InlineData: &InlineData{MimeType: "image/jpeg", Data: "AAAA"}},
+	}}}}}
+	images := r.Images()
+	if len(images) != 1 || images[0].MimeType != "image/jpeg" {
+		t.Errorf("Images(): got %+v", images)
+	}
+
+	var nilResp *Response
+	if nilResp.Images() != nil {
+		t.Error("Images() on nil receiver should be nil")
+	}
+}
+
+func TestInlineData_DecodeInvalid(t *testing.T) {
+	if _, err := (InlineData{Data: "not base64!"}).Decode(); err == nil {
+		t.Fatal("expected decode error")
+	}
+}
+
+func TestResponse_PartsMixedOrder(t *testing.T) {
+	body := `{"candidates":[{"content":{"role":"model","parts":[
+		{"text":"Let me check."},
+		{"functionCall":{"name":"get_weather","args":{"city":"Oslo"}}},
+		{"inlineData":{"mimeType":"image/png","data":"AAAA"}},
+		{"text":"Done."}
+	]}}]}`
+	var r Response
+	if err := json.Unmarshal([]byte(body), &r); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	parts := r.Parts()
+	want := []PartKind{PartKindText, PartKindFunctionCall, PartKindInlineData, PartKindText}
+	if len(parts) != len(want) {
+		t.Fatalf("Parts(): got %d parts, want %d", len(parts), len(want))
+	}
+	for i, k := range want {
+		if got := parts[i].Kind(); got != k {
+			t.Errorf("parts[%d].Kind(): got %q, want %q", i, got, k)
+		}
+	}
+	if parts[0].Text != "Let me check." || parts[3].Text != "Done." {
+		t.Errorf("text parts out of order: %+v", parts)
+	}
+	if parts[1].FunctionCall.Name != "get_weather" {
+		t.Errorf("function call part: %+v", parts[1])
+	}
+}
+
+func TestResponse_PartsNil(t *testing.T) {
+	var r *Response
+	if r.Parts() != nil {
+		t.Error("Parts() on nil receiver should be nil")
+	}
+	if (&Response{}).Parts() != nil {
+		t.Error("Parts() with no candidates should be nil")
+	}
+	if got := (ResponsePart{}).Kind(); got != PartKindUnknown {
+		t.Errorf("empty part Kind(): got %q", got)
+	}
+}
+
+func TestResponse_TextAt(t *testing.T) {
+	r := &Response{Candidates: []Candidate{
+		{Content: ResponseContent{Parts: []ResponsePart{{Text: "first"}}}},
+		{Content: ResponseContent{Parts: []ResponsePart{{Text: "plan", Thought: true}, {Text: "sec"}, {Text: "ond"}}}},
+	}}
+	for i, want := range []string{"first", "second"} {
+		if got, err := r.TextAt(i); err != nil || got != want {
+			t.Errorf("TextAt(%d): got %q, %v; want %q", i, got, err, want)
+		}
+	}
+	for _, i := range []int{-1, 2} {
+		if _, err := r.TextAt(i); err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Errorf("TextAt(%d): expected out of range error, got %v", i, err)
+		}
+	}
+	var nilResp *Response
+	if _, err := nilResp.TextAt(0); err == nil {
+		t.Error("nil response: expected error")
+	}
+}
+
+func TestResponse_SelectCandidate(t *testing.T) {
+	resp := &Response{Candidates: []Candidate{
+		{Content: ResponseContent{Parts: []ResponsePart{{Text: "not json"}}}, FinishReason: "STOP"},
+		{Content: ResponseContent{Parts: []ResponsePart{{Text: `{"ok":true}`}}}, FinishReason: "STOP"},
+		{FinishReason: "SAFETY"},
+	}}
+	isJSON := func(c Candidate) bool { return json.Valid([]byte(c.Text())) }
+
+	tests := []struct {
+		name      string
+		pred      func(Candidate) bool
+		wantIndex int // -1 for no match
+	}{
+		{"first", func(c Candidate) bool { return c.FinishReason == "STOP" }, 0},
+		{"later", isJSON, 1},
+		{"none", func(c Candidate) bool { return c.FinishReason == "MAX_TOKENS" }, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := resp.SelectCandidate(tt.pred)
+			if tt.wantIndex < 0 {
+				if ok || got != nil {
+					t.Errorf("expected no match, got %+v", got)
+				}
+				return
+			}
+			if !ok || got != &resp.Candidates[tt.wantIndex] {
+				t.Errorf("expected candidate %d, got %+v (ok=%v)", tt.wantIndex, got, ok)
+			}
+		})
+	}
+
+	var nilResp *Response
+	if _, ok := nilResp.SelectCandidate(isJSON); ok {
+		t.Error("nil response should not match")
+	}
+}
+
+func TestCandidate_TokenLogprobs(t *testing.T) {
+	body := `{"candidates":[{"content":{"parts":[{"text":"Hi there"}]},"avgLogprobs":-0.25,
+		"logprobsResult":{
+			"topCandidates":[{"candidates":[{"token":"Hi","tokenId":17,"logProbability":-0.1},{"token":"Hello","tokenId":18,"logProbability":-2.4}]}],
+			"chosenCandidates":[{"token":"Hi","tokenId":17,"logProbability":-0.1},{"token":" there","tokenId":42,"logProbability":-0.4}]}}]}`
+	var resp Response
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	cand := &resp.Candidates[0]
+	got := cand.TokenLogprobs()
+	want := []TokenLogprob{{Token: "Hi", TokenID: 17, LogProbability: -0.1}, {Token: " there", TokenID: 42, LogProbability: -0.4}}
+	if !slices.Equal(got, want) {
+		t.Errorf("TokenLogprobs: got %+v, want %+v", got, want)
+	}
+	if cand.AvgLogprobs != -0.25 {
+		t.Errorf("AvgLogprobs: got %v", cand.AvgLogprobs)
+	}
+	if top := cand.LogprobsResult.TopCandidates; len(top) != 1 || top[0].Candidates[1].Token != "Hello" {
+		t.Errorf("TopCandidates: got %+v", top)
+	}
+
+	if got := (&Candidate{}).TokenLogprobs(); got != nil {
+		t.Errorf("no logprobs: got %+v", got)
+	}
+	if got := (*Candidate)(nil).TokenLogprobs(); got != nil {
+		t.Errorf("nil candidate: got %+v", got)
+	}
+}
+
+func TestResponse_CitationSources(t *testing.T) {
+	body := `{"candidates":[{"content":{"parts":[{"text":"quoted text"}]},"finishReason":"STOP",
+		"citationMetadata":{"citationSources":[
+			{"startIndex":0,"endIndex":6,"uri":"https://example.com/a","license":"CC-BY-4.0"},
+			{"endIndex":11,"uri":"https://example.com/b"}]},
+		"futureField":{"x":1}}]}`
+	mock := &mockDoer{statusCode: 200, respBody: body}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	resp, err := c.Generate(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []CitationSource{
+		{StartIndex: 0, EndIndex: 6, URI: "https://example.com/a", License: "CC-BY-4.0"},
+		{EndIndex: 11, URI: "https://example.com/b"},
+	}
+	if got := resp.CitationSources(); !slices.Equal(got, want) {
+		t.Errorf("CitationSources: got %+v, want %+v", got, want)
+	}
+	if resp.Text() != "quoted text" {
+		t.Errorf("text: got %q", resp.Text())
+	}
+
+	if got := (&Response{Candidates: []Candidate{{}}}).CitationSources(); got != nil {
+		t.Errorf("no citations: got %+v", got)
+	}
+	if got := (*Response)(nil).CitationSources(); got != nil {
+		t.Errorf("nil response: got %+v", got)
+	}
+}
+
+func TestProbability_Ordering(t *testing.T) {
+	levels := []Probability{ProbabilityUnspecified, ProbabilityNegligible, ProbabilityLow, ProbabilityMedium, ProbabilityHigh}
+	for i, rated := range levels {
+		for j, threshold := range levels {
+			r := SafetyRating{Probability: rated}
+			if got, want := r.AtLeast(threshold), i >= j; got != want {
+				t.Errorf("%v.AtLeast(%v): got %v, want %v", rated, threshold, got, want)
+			}
+		}
+	}
+	if (SafetyRating{Probability: "SOMETHING_NEW"}).AtLeast(ProbabilityNegligible) {
+		t.Error("unknown probabilities should rank lowest")
+	}
+	for _, threshold := range []Probability{"high", "SOMETHING_NEW", ""} {
+		if (SafetyRating{Probability: ProbabilityHigh}).AtLeast(threshold) {
+			t.Errorf("AtLeast(%q): an unknown threshold should match nothing", threshold)
+		}
+	}
+}
+
+func TestProbability_JSONRoundTrip(t *testing.T) {
+	body := `[{"category":"HARM_CATEGORY_HARASSMENT","probability":"MEDIUM"},{"category":"HARM_CATEGORY_HATE_SPEECH","probability":"SOMETHING_NEW"}]`
+	var ratings []SafetyRating
+	if err := json.Unmarshal([]byte(body), &ratings); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	data, err := json.Marshal(ratings)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if string(data) != body {
+		t.Errorf("round trip changed the ratings:\ngot  %s\nwant %s", data, body)
+	}
+}
+
+func TestCandidate_ExceedsSafety(t *testing.T) {
+	c := Candidate{SafetyRatings: []SafetyRating{
+		{Category: HarmCategoryHarassment, Probability: ProbabilityNegligible},
+		{Category: HarmCategoryHateSpeech, Probability: ProbabilityMedium},
+	}}
+	tests := []struct {
+		p    Probability
+		want bool
+	}{
+		{"high", false},
+		{ProbabilityLow, true},
+		{ProbabilityMedium, true},
+		{ProbabilityHigh, false},
+	}
+	for _, tt := range tests {
+		if got := c.ExceedsSafety(tt.p); got != tt.want {
+			t.Errorf("ExceedsSafety(%v): got %v, want %v", tt.p, got, tt.want)
+		}
+	}
+	if (Candidate{}).ExceedsSafety(ProbabilityNegligible) {
+		t.Error("a candidate without ratings should not exceed any level")
+	}
+}
+
+func TestMessages_RoundTrip(t *testing.T) {
+	msgs := []Message{
+		{Role: RoleUser, Text: "Hi"},
+		{Role: RoleModel, Text: "Hello! How can I help?"},
+		{Role: RoleUser, Text: ""},
+	}
+	contents := MessagesToContents(msgs)
+	if len(contents) != 3 || contents[1].Role != RoleModel || len(contents[1].Parts) != 1 || contents[1].Parts[0].Text != "Hello! How can I help?" {
+		t.Fatalf("contents: got %+v", contents)
+	}
+	if got := ContentsToMessages(contents); !slices.Equal(got, msgs) {
+		t.Errorf("round trip: got %+v, want %+v", got, msgs)
+	}
+}
+
+func TestContentsToMessages_MultiPart(t *testing.T) {
+	contents := []Content{
+		{Role: RoleUser, Parts: []Part{{Text: "Describe "}, {InlineData: &InlineData{MimeType: "image/png", Data: "AAAA"}}, {Text: "this image."}}},
+		{Role: RoleModel, Parts: []Part{{FunctionCall: &FunctionCall{Name: "f"}}}},
+	}
+	want := []Message{{Role: RoleUser, Text: "Describe this image."}, {Role: RoleModel, Text: ""}}
+	got := ContentsToMessages(contents)
+	if !slices.Equal(got, want) {
+		t.Fatalf("messages: got %+v, want %+v", got, want)
+	}
+	if again := ContentsToMessages(MessagesToContents(got)); !slices.Equal(again, got) {
+		t.Errorf("second round trip: got %+v", again)
+	}
+	if got := MessagesToContents(nil); len(got) != 0 {
+		t.Errorf("nil messages: got %+v", got)
+	}
+}
+
+func TestResponse_Thoughts(t *testing.T) {
+	body := `{"candidates":[{"content":{"role":"model","parts":[
+		{"text":"The user wants a sum. ","thought":true},
+		{"text":"2 + 2 is 4, so","thought":true},
+		{"text":"The answer is "},
+		{"text":"4."}]}}]}`
+	resp, err := ParseResponse([]byte(body))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := resp.Text(); got != "The answer is 4." {
+		t.Errorf("Text: got %q", got)
+	}
+	if got := resp.Thoughts(); got != "The user wants a sum. 2 + 2 is 4, so" {
+		t.Errorf("Thoughts: got %q", got)
+	}
+
+	single := Candidate{Content: ResponseContent{Parts: []ResponsePart{{Text: "thinking", Thought: true}}}}
+	if single.Text() != "" || single.Thoughts() != "thinking" {
+		t.Errorf("single thought part: Text %q, Thoughts %q", single.Text(), single.Thoughts())
+	}
+	if (*Response)(nil).Thoughts() != "" || (&Response{}).Thoughts() != "" {
+		t.Error("expected empty thoughts without candidates")
+	}
+}
+
+func TestResponse_FinishReasons(t *testing.T) {
+	var resp Response
+	body := `{"candidates":[{"finishReason":"STOP"},{"finishReason":"MAX_TOKENS"},{"finishReason":"SAFETY"}]}`
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	got := resp.FinishReasons()
+	want := []FinishReason{FinishReasonStop, FinishReasonMaxTokens, FinishReasonSafety}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	var nilResp *Response
+	if got := nilResp.FinishReasons(); got != nil {
+		t.Errorf("nil response: got %v", got)
+	}
+}
+
+func TestResponse_ContinuationContents(t *testing.T) {
+	resp := &Response{Candidates: []Candidate{{
+		Content:      ResponseContent{Role: RoleModel, Parts: []ResponsePart{{Text: "Once upon "}, {Text: "a time"}}},
+		FinishReason: FinishReasonMaxTokens,
+	}}}
+
+	got := resp.ContinuationContents("Tell a story")
+	if err := validateContents(got); err != nil {
+		t.Fatalf("contents should be valid for GenerateContents: %v", err)
+	}
+	want := []struct{ role, text string }{
+		{RoleUser, "Tell a story"},
+		{RoleModel, "Once upon a time"},
+		{RoleUser, continuePrompt},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("contents: got %d turns, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if got[i].Role != w.role || len(got[i].Parts) != 1 || got[i].Parts[0].Text != w.text {
+			t.Errorf("turn %d: got %+v, want role %q text %q", i, got[i], w.role, w.text)
+		}
+	}
+
+	var nilResp *Response
+	if got := nilResp.ContinuationContents("Tell a story"); len(got) != 1 || got[0].Parts[0].Text != "Tell a story" {
+		t.Errorf("nil response: got %+v, want only the prompt", got)
+	}
+}
+
+func TestSchema_PropertyOrderingJSON(t *testing.T) {
+	s := Schema{
+		Type: "OBJECT",
+		Properties: map[string]*Schema{
+			"name": {Type: "STRING"},
+			"age":  {Type: "INTEGER"},
+		},
+		PropertyOrdering: []string{"name", "age"},
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var got struct {
+		PropertyOrdering []string `json:"propertyOrdering"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !slices.Equal(got.PropertyOrdering, []string{"name", "age"}) {
+		t.Errorf("propertyOrdering: got %v in %s", got.PropertyOrdering, data)
+	}
+
+	data, err = json.Marshal(Schema{Type: "STRING"})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if strings.Contains(string(data), "propertyOrdering") {
+		t.Errorf("empty ordering should be omitted: %s", data)
+	}
+}
+
+func TestTool_JSONOmitsEmptySiblings(t *testing.T) {
+	tests := map[string]struct {
+		tool Tool
+		want string
+	}{
+		"google search only": {Tool{GoogleSearch: &GoogleSearch{}}, `{"googleSearch":{}}`},
+		"functions only": {
+			Tool{FunctionDeclarations: []FunctionDeclaration{{Name: "lookup"}}},
+			`{"functionDeclarations":[{"name":"lookup"}]}`,
+		},
+		"empty functions": {Tool{GoogleSearch: &GoogleSearch{}, FunctionDeclarations: []FunctionDeclaration{}}, `{"googleSearch":{}}`},
+		"empty":           {Tool{}, `{}`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := json.Marshal(tt.tool)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("got %s, want %s", data, tt.want)
+			}
+			var back Tool
+			if err := json.Unmarshal(data, &back); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if (back.GoogleSearch != nil) != (tt.tool.GoogleSearch != nil) || len(back.FunctionDeclarations) != len(tt.tool.FunctionDeclarations) {
+				t.Errorf("round trip: got %+v, want %+v", back, tt.tool)
+			}
+		})
+	}
+}
+
+func TestEnumSchema(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: `{"candidates":[{"content":{"parts":[{"text":"\"negative\""}]}}]}`}
+	c := mustNew(t, "key", WithDoer(mock))
+
+	resp, err := c.Generate(context.Background(), "classify: awful", WithResponseSchema(EnumSchema("positive", "negative")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `"responseMimeType":"application/json","responseSchema":{"type":"STRING","enum":["positive","negative"]}`
+	if !strings.Contains(string(mock.body), want) {
+		t.Errorf("request missing %s: %s", want, mock.body)
+	}
+	var label string
+	if err := resp.JSON(&label); err != nil || label != "negative" {
+		t.Errorf("label: got %q, %v", label, err)
+	}
+}
+
+func TestUsageMetadata_Cost(t *testing.T) {
+	u := UsageMetadata{PromptTokenCount: 2500, CandidatesTokenCount: 400, TotalTokenCount: 2900}
+	p := Pricing{InputPer1K: 0.002, OutputPer1K: 0.01}
+
+	// 2.5 * 0.002 + 0.4 * 0.01
+	if got, want := u.Cost(p), 0.009; math.Abs(got-want) > 1e-12 {
+		t.Errorf("Cost: got %v, want %v", got, want)
+	}
+	if got := (UsageMetadata{}).Cost(p); got != 0 {
+		t.Errorf("zero usage: got %v, want 0", got)
+	}
+}
+
+func TestResponse_UniqueTexts(t *testing.T) {
+	cand := func(text string) Candidate {
+		return Candidate{Content: ResponseContent{Parts: []ResponsePart{{Text: text}}}}
+	}
+	resp := &Response{Candidates: []Candidate{cand("a"), cand("a"), cand("b"), cand("a"), cand("c"), cand("b")}}
+
+	if got, want := resp.UniqueTexts(), []string{"a", "b", "c"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	var nilResp *Response
+	if got := nilResp.UniqueTexts(); got != nil {
+		t.Errorf("nil response: got %q", got)
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	body := `{"candidates":[{"content":{"role":"model","parts":[{"text":"hi"}]},"finishReason":"STOP"}],
+		"usageMetadata":{"promptTokenCount":2,"candidatesTokenCount":1,"totalTokenCount":3}}`
+	resp, err := ParseResponse([]byte(body))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Text() != "hi" || resp.UsageMetadata.TotalTokenCount != 3 || resp.Candidates[0].FinishReason != FinishReasonStop {
+		t.Errorf("got %+v", resp)
+	}
+
+	if _, err := ParseResponse([]byte(`{"candidates":[`)); err == nil || !strings.Contains(err.Error(), "unmarshal response") {
+		t.Errorf("malformed body: got %v", err)
+	}
+	if _, err := ParseResponse(make([]byte, maxResponseBytes+1)); err == nil || !strings.Contains(err.Error(), "byte limit") {
+		t.Errorf("oversized body: got %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package gemini
+
+import "sync"
+
+// usageTotals accumulates token usage across calls. It is shared by the
+// per-model copies of a Client.
+type usageTotals struct {
+	mu    sync.Mutex
+	total UsageMetadata
+}
+
+func (u *usageTotals) add(m UsageMetadata) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.total.PromptTokenCount += m.PromptTokenCount
+	u.total.CandidatesTokenCount += m.CandidatesTokenCount
+	u.total.TotalTokenCount += m.TotalTokenCount
+	u.total.CachedContentTokenCount += m.CachedContentTokenCount
+}
+
+// TotalUsage returns the token usage summed over every successful generate
+// call made with the client since it was created or last reset, streaming
+// included. Responses served from WithCache are not counted. It is safe to
+// call concurrently with generation.
+func (c *Client) TotalUsage() UsageMetadata {
+	c.usage.mu.Lock()
+	defer c.usage.mu.Unlock()
+	return c.usage.total
+}
+
+// ResetUsage sets the totals reported by TotalUsage back to zero.
+func (c *Client) ResetUsage() {
+	c.usage.mu.Lock()
+	defer c.usage.mu.Unlock()
+	c.usage.total = UsageMetadata{}
+}
@@ -0,0 +1,45 @@
+package gemini
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestClient_TotalUsage(t *testing.T) {
+	body := `{"candidates":[{"content":{"parts":[{"text":"ok"}]}}],` +
+		`"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":4,"totalTokenCount":7}}`
+	c := mustNew(t, "key", WithDoer(DoerFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(body))}, nil
+	})))
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Generate(context.Background(), "test"); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if _, err := c.Generate(context.Background(), "test", WithRequestModel("gemini-2.5-pro")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.GenerateFromJSON(context.Background(), []byte(`{"contents":[{"parts":[{"text":"test"}]}]}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := UsageMetadata{PromptTokenCount: 36, CandidatesTokenCount: 48, TotalTokenCount: 84}
+	if got := c.TotalUsage(); got != want {
+		t.Errorf("TotalUsage: got %+v, want %+v", got, want)
+	}
+	c.ResetUsage()
+	if got := c.TotalUsage(); got != (UsageMetadata{}) {
+		t.Errorf("after ResetUsage: got %+v", got)
+	}
+}
@@ -0,0 +1,181 @@
+package gemini
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// WithRecorder saves every HTTP exchange to a JSON file in dir, creating dir
+// if needed, so it can be replayed later with WithReplay. Files are named
+// after a hash of the method, URL, and request body; a repeated request
+// overwrites its earlier recording. Request headers, and so the API key, are
+// never written. Responses are buffered in full before they are returned,
+// which delays the first streamed chunk until the stream ends.
+func WithRecorder(dir string) Option {
+	return func(c *Client) {
+		c.recordDir = dir
+		c.recordSet = true
+	}
+}
+
+// WithReplay serves responses recorded by WithRecorder from dir instead of
+// calling the API, for deterministic tests and offline demos. A request with
+// no matching recording fails with an error wrapping ErrNoRecording. It
+// replaces any Doer set with WithDoer or WithHTTPClient.
+func WithReplay(dir string) Option {
+	return func(c *Client) {
+		c.replayDir = dir
+		c.replaySet = true
+	}
+}
+
+// vcrExchange is the file format of a recorded exchange. The request fields
+// are informational; matching uses the file name.
+type vcrExchange struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	RequestBody string      `json:"requestBody,omitempty"`
+	StatusCode  int         `json:"statusCode"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        string      `json:"body,omitempty"`
+	BodyBytes   []byte      `json:"bodyBytes,omitempty"` // set instead of Body when not valid UTF-8
+}
+
+// vcrPath returns the recording file for a request.
+func vcrPath(dir string, req *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", req.Method, req.URL.String())
+	h.Write(body)
+	return filepath.Join(dir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+// readRequestBody reads req.Body and replaces it with an equivalent reader.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("gemini: read request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// recordDoer implements WithRecorder around the underlying Doer.
+type recordDoer struct {
+	next Doer
+	dir  string
+}
+
+func (r *recordDoer) Do(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes+1))
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("gemini: record exchange: read response: %w", err)
+	}
+	if len(body) > maxResponseBytes {
+		return nil, fmt.Errorf("gemini: record exchange: response exceeds %d bytes", maxResponseBytes)
+	}
+
+	ex := vcrExchange{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+	}
+	if utf8.Valid(reqBody) {
+		ex.RequestBody = string(reqBody)
+	}
+	if utf8.Valid(body) {
+		ex.Body = string(body)
+	} else {
+		ex.BodyBytes = body
+	}
+	if err := writeExchange(vcrPath(r.dir, req, reqBody), &ex); err != nil {
+		return nil, fmt.Errorf("gemini: record exchange: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// writeExchange writes ex to path atomically, so concurrent recordings of
+// the same request never leave a partial file.
+func writeExchange(path string, ex *vcrExchange) error {
+	data, err := json.MarshalIndent(ex, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".recording-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// replayDoer implements WithReplay.
+type replayDoer struct {
+	dir string
+}
+
+func (r *replayDoer) Do(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(vcrPath(r.dir, req, reqBody))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoRecording, req.Method, req.URL.Redacted())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gemini: replay exchange: %w", err)
+	}
+	var ex vcrExchange
+	if err := json.Unmarshal(data, &ex); err != nil {
+		return nil, fmt.Errorf("gemini: replay exchange: %w", err)
+	}
+	body := ex.BodyBytes
+	if body == nil {
+		body = []byte(ex.Body)
+	}
+	return &http.Response{
+		StatusCode: ex.StatusCode,
+		Status:     fmt.Sprintf("%d %s", ex.StatusCode, http.StatusText(ex.StatusCode)),
+		Header:     ex.Header,
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
@@ -0,0 +1,79 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	body := `{"candidates":[{"content":{"parts":[{"text":"recorded"}]}}]}`
+	mock := &mockDoer{statusCode: 200, respBody: body}
+	rec := mustNew(t, "secret-key", WithDoer(mock), WithRecorder(dir))
+
+	resp, err := rec.Generate(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if resp.Text() != "recorded" {
+		t.Errorf("record: got %q", resp.Text())
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("expected one recording, got %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	if strings.Contains(string(data), "secret-key") {
+		t.Error("recording must not contain the API key")
+	}
+	if !strings.Contains(string(data), `"statusCode": 200`) || !strings.Contains(string(data), "hello") {
+		t.Errorf("unexpected recording: %s", data)
+	}
+
+	replay := mustNew(t, "other-key", WithReplay(dir))
+	resp, err = replay.Generate(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if resp.Text() != "recorded" {
+		t.Errorf("replay: got %q", resp.Text())
+	}
+
+	_, err = replay.Generate(context.Background(), "a different prompt")
+	if !errors.Is(err, ErrNoRecording) {
+		t.Errorf("unmatched request: got %v, want ErrNoRecording", err)
+	}
+}
+
+func TestReplay_ErrorStatus(t *testing.T) {
+	dir := t.TempDir()
+	mock := &mockDoer{statusCode: 429, respBody: `{"error":{"code":429,"message":"slow down","status":"RESOURCE_EXHAUSTED"}}`}
+	rec := mustNew(t, "key", WithDoer(mock), WithRecorder(dir))
+	if _, err := rec.Generate(context.Background(), "hi"); err == nil {
+		t.Fatal("record: expected error")
+	}
+
+	replay := mustNew(t, "key", WithReplay(dir))
+	_, err := replay.Generate(context.Background(), "hi")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 429 || apiErr.Message != "slow down" {
+		t.Errorf("replayed error: got %v", err)
+	}
+}
+
+func TestRecorder_InvalidOptions(t *testing.T) {
+	dir := t.TempDir()
+	for name, opts := range map[string][]Option{
+		"both":         {WithRecorder(dir), WithReplay(dir)},
+		"empty record": {WithRecorder("")},
+		"empty replay": {WithReplay("")},
+	} {
+		if _, err := New("key", opts...); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// VerifyAPIKey checks the client's API key by listing a single model, without
+// generating anything. A 401 or 403 yields an error wrapping
+// ErrInvalidAPIKey; other failures, such as network errors or 5xx statuses,
+// are returned as dependency errors and mean the key could not be checked.
+func (c *Client) VerifyAPIKey(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.modelsEndpoint(url.Values{"pageSize": {"1"}}), nil)
+	if err != nil {
+		return fmt.Errorf("gemini: create request: %w", err)
+	}
+	req.Header.Set("x-goog-api-key", c.apiKey)
+
+	var raw []byte
+	_, err = c.send(req, &raw)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("%w: %w", ErrInvalidAPIKey, err)
+	}
+	return err
+}
+
+// modelsEndpoint returns the URL of the models collection, which is the base
+// URL itself unless it points at the API version root.
+func (c *Client) modelsEndpoint(query url.Values) string {
+	u := *c.base
+	if !strings.HasSuffix(c.baseURL, "/models") {
+		u = *u.JoinPath("models")
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,65 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestVerifyAPIKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		doErr       error
+		wantErr     bool
+		wantInvalid bool
+	}{
+		{"valid", 200, `{"models":[{"name":"models/gemini-3-pro-preview"}]}`, nil, false, false},
+		{"unauthorized", 401, `{"error":{"code":401,"message":"API key not valid","status":"UNAUTHENTICATED"}}`, nil, true, true},
+		{"forbidden", 403, `{"error":{"code":403,"message":"permission denied","status":"PERMISSION_DENIED"}}`, nil, true, true},
+		{"server error", 503, `{"error":{"code":503,"message":"overloaded","status":"UNAVAILABLE"}}`, nil, true, false},
+		{"network error", 0, "", errors.New("connection refused"), true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockDoer{statusCode: tt.status, respBody: tt.body, err: tt.doErr}
+			c := mustNew(t, "secret", WithDoer(mock))
+
+			err := c.VerifyAPIKey(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error: got %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := errors.Is(err, ErrInvalidAPIKey); got != tt.wantInvalid {
+				t.Errorf("errors.Is(ErrInvalidAPIKey): got %v, want %v (err %v)", got, tt.wantInvalid, err)
+			}
+			var apiErr *APIError
+			if tt.status >= 400 && (!errors.As(err, &apiErr) || apiErr.StatusCode != tt.status) {
+				t.Errorf("expected *APIError with status %d, got %v", tt.status, err)
+			}
+
+			if mock.req.Method != http.MethodGet {
+				t.Errorf("method: got %s, want GET", mock.req.Method)
+			}
+			if got := mock.req.URL.String(); got != defaultBaseURL+"?pageSize=1" {
+				t.Errorf("URL: got %s", got)
+			}
+			if got := mock.req.Header.Get("x-goog-api-key"); got != "secret" {
+				t.Errorf("api key header: got %q", got)
+			}
+		})
+	}
+}
+
+func TestVerifyAPIKey_VersionRootBaseURL(t *testing.T) {
+	mock := &mockDoer{statusCode: 200, respBody: `{"models":[]}`}
+	c := mustNew(t, "key", WithDoer(mock), WithBaseURL("https://example.com/v1beta"))
+
+	if err := c.VerifyAPIKey(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := mock.req.URL.String(); got != "https://example.com/v1beta/models?pageSize=1" {
+		t.Errorf("URL: got %s", got)
+	}
+}